@@ -0,0 +1,111 @@
+package stream
+
+import "sync"
+
+// ack counts the references of a tracked message and its derived messages.
+type ack struct {
+	mu   sync.Mutex
+	refs int
+	done bool
+	fn   func(err error)
+}
+
+func (a *ack) retain() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.refs++
+}
+
+func (a *ack) release(err error) {
+	a.mu.Lock()
+	if a.done {
+		a.mu.Unlock()
+		return
+	}
+	a.refs--
+	if err == nil && a.refs > 0 {
+		a.mu.Unlock()
+		return
+	}
+	a.done = true
+	a.mu.Unlock()
+	a.fn(err)
+}
+
+// WithAck wraps v in an Envelope tracked for acknowledgement, fn is called
+// once with nil when the message and every message derived from it were
+// consumed or with the first error returned while consuming any of them.
+//
+// A message is derived when a stage sends it with stream.Rewrap or
+// stream.Join, messages are tracked while they are in a Chan or being consumed,
+// if the stream is cancelled the messages in transit might not be acknowledged.
+//		return p.Send(stream.WithAck(msg, func(err error) {
+//			if err == nil {
+//				commit(msg.Offset)
+//			}
+//		}))
+func WithAck(v interface{}, fn func(err error)) Envelope {
+	e, ok := v.(Envelope)
+	if !ok {
+		e = Envelope{Value: v}
+	}
+	acks := make([]*ack, len(e.acks), len(e.acks)+1)
+	copy(acks, e.acks)
+	e.acks = append(acks, &ack{fn: fn})
+	return e
+}
+
+// Join wraps v in an Envelope tracked by the acknowledgements of all srcs,
+// it's used by stages that combine several messages into one, if none of the
+// srcs is tracked v is returned as is.
+func Join(v interface{}, srcs ...interface{}) interface{} {
+	var acks []*ack
+	seen := map[*ack]bool{}
+	for _, s := range srcs {
+		e, ok := s.(Envelope)
+		if !ok {
+			continue
+		}
+		for _, a := range e.acks {
+			if seen[a] {
+				continue
+			}
+			seen[a] = true
+			acks = append(acks, a)
+		}
+	}
+	if len(acks) == 0 {
+		return v
+	}
+	e, ok := v.(Envelope)
+	if !ok {
+		e = Envelope{Value: v}
+	}
+	e.acks = append(append([]*ack{}, e.acks...), acks...)
+	return e
+}
+
+// Retain holds a reference of a tracked message, it is used by stages that
+// keep messages after the consume func returns, each Retain must be followed
+// by a Release.
+func Retain(v interface{}) {
+	e, ok := v.(Envelope)
+	if !ok {
+		return
+	}
+	for _, a := range e.acks {
+		a.retain()
+	}
+}
+
+// Release releases a reference of a tracked message, if err is not nil the
+// message is acknowledged with the error.
+func Release(v interface{}, err error) {
+	e, ok := v.(Envelope)
+	if !ok {
+		return
+	}
+	for _, a := range e.acks {
+		a.release(err)
+	}
+}
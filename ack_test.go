@@ -0,0 +1,96 @@
+package stream_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stdiopt/stream"
+	"github.com/stdiopt/stream/strmutil"
+)
+
+func TestWithAck(t *testing.T) {
+	testError := errors.New("test")
+	tests := []struct {
+		name    string
+		input   [][]int
+		failOn  int
+		wantErr map[int]error
+	}{
+		{
+			name:    "acks after every derived message is consumed",
+			input:   [][]int{{1, 2}, {3}, {}},
+			wantErr: map[int]error{0: nil, 1: nil, 2: nil},
+		},
+		{
+			name:    "nacks with consumer error",
+			input:   [][]int{{1, 2, 3}},
+			failOn:  2,
+			wantErr: map[int]error{0: testError},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mu := sync.Mutex{}
+			consumed := map[int]int{}
+			got := map[int]error{}
+
+			source := func(p stream.Proc) error {
+				for i, v := range tt.input {
+					i := i
+					want := len(v) * 2 // both branches
+					msg := stream.Wrap(v, stream.Meta{"id": i})
+					err := p.Send(stream.WithAck(msg, func(err error) {
+						mu.Lock()
+						defer mu.Unlock()
+						if _, ok := got[i]; ok {
+							t.Errorf("ack called twice for %d", i)
+						}
+						if err == nil && consumed[i] != want {
+							t.Errorf("\nwant consumed: %v\n got consumed: %v\n", want, consumed[i])
+						}
+						got[i] = err
+					}))
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+			sink := func(p stream.Proc) error {
+				return p.Consume(func(v interface{}) error {
+					if stream.Unwrap(v) == tt.failOn {
+						return testError
+					}
+					mu.Lock()
+					defer mu.Unlock()
+					consumed[stream.MetaOf(v)["id"].(int)]++
+					return nil
+				})
+			}
+
+			err := stream.Run(
+				source,
+				stream.Buffer(2, strmutil.Unslice()),
+				stream.Broadcast(
+					sink,
+					stream.Workers(2, sink),
+				),
+			)
+			if want := tt.failOn != 0; (err != nil) != want {
+				t.Errorf("\nwant err: %v\n got err: %v\n", want, err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(got) != len(tt.wantErr) {
+				t.Fatalf("\nwant: %v\n got: %v\n", tt.wantErr, got)
+			}
+			for i, want := range tt.wantErr {
+				if err := got[i]; err != want {
+					t.Errorf("\nwant[%d]: %v\n got[%d]: %v\n", i, want, i, err)
+				}
+			}
+		})
+	}
+}
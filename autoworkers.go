@@ -0,0 +1,244 @@
+package stream
+
+import (
+	"context"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// AutoScale configures AutoWorkers.
+type AutoScale struct {
+	// Min and Max number of workers, Min defaults to 1 and Max to Min.
+	Min int
+	Max int
+	// Buffer is the size of the input channel the workers consume from,
+	// defaults to Max.
+	Buffer int
+	// Interval between scale decisions, defaults to 1 second.
+	Interval time.Duration
+	// Backlog is the number of messages waiting in the input channel above
+	// which a worker is added, defaults to 0.
+	Backlog int
+	// OnScale is called with every scale decision.
+	OnScale func(e ScaleEvent)
+}
+
+// ScaleEvent describes a scale decision of AutoWorkers.
+type ScaleEvent struct {
+	From, To int
+	// Backlog is the number of messages waiting in the input channel.
+	Backlog int
+	// Rate is the number of messages per second received since the last
+	// decision.
+	Rate float64
+	// Latency is the average time the workers spent per message since the
+	// last decision.
+	Latency time.Duration
+}
+
+// AutoWorkers runs between s.Min and s.Max workers of pfns as Workers does,
+// workers are added when the input backlog is above s.Backlog or when the
+// input rate times the message latency needs more workers and are removed
+// one by one when they aren't needed.
+//
+// Removed workers finish the message they're consuming and are still counted
+// until they return so there are never more than s.Max workers running.
+//		stream.AutoWorkers(stream.AutoScale{Min: 1, Max: 8}, strmutil.HTTPGet(nil))
+func AutoWorkers(s AutoScale, pfns ...ProcFunc) ProcFunc {
+	if len(pfns) == 0 {
+		panic("no funcs")
+	}
+	if s.Min <= 0 {
+		s.Min = 1
+	}
+	if s.Max < s.Min {
+		s.Max = s.Min
+	}
+	if s.Buffer <= 0 {
+		s.Buffer = s.Max
+	}
+	if s.Interval <= 0 {
+		s.Interval = time.Second
+	}
+	return composite(func(p Proc) error {
+		if t := topologyFrom(p.Context()); t != nil {
+			return t.add(&Topology{Kind: "autoworkers", MinWorkers: s.Min, Workers: s.Max}, pfns...)
+		}
+		eg, ctx := errgroup.WithContext(p.Context())
+		a := &autoPool{
+			AutoScale: s,
+			ctx:       ctx,
+			eg:        eg,
+			out:       p,
+			pfns:      pfns,
+			ch:        NewChan(ctx, s.Buffer),
+			exited:    make(chan struct{}, 1),
+			inputDone: make(chan struct{}),
+		}
+		eg.Go(func() error {
+			defer close(a.inputDone)
+			defer a.ch.Close()
+			return p.Consume(func(v interface{}) error {
+				atomic.AddInt64(&a.arrived, 1)
+				return a.ch.Send(v)
+			})
+		})
+		a.mu.Lock()
+		for i := 0; i < s.Min; i++ {
+			a.start()
+		}
+		a.mu.Unlock()
+		eg.Go(a.scale)
+		return eg.Wait()
+	})
+}
+
+type autoPool struct {
+	arrived int64 // messages received since the last decision
+	handled int64 // messages consumed since the last decision
+	latency int64 // nanoseconds spent consuming since the last decision
+
+	AutoScale
+	ctx       context.Context
+	eg        *errgroup.Group
+	out       Proc
+	pfns      []ProcFunc
+	ch        Chan
+	exited    chan struct{}
+	inputDone chan struct{}
+
+	mu      sync.Mutex
+	running int             // workers running including the removed ones
+	quits   []chan struct{} // quit channels of the active workers
+}
+
+// start starts a worker, mu must be held.
+func (a *autoPool) start() {
+	quit := make(chan struct{})
+	a.quits = append(a.quits, quit)
+	a.running++
+	c := autoConsumer{a, quit}
+	a.eg.Go(func() error {
+		defer func() {
+			a.mu.Lock()
+			a.running--
+			a.mu.Unlock()
+			select {
+			case a.exited <- struct{}{}:
+			default:
+			}
+		}()
+		return runLine(proc{a.ctx, c, a.out}, a.pfns)
+	})
+}
+
+// stop signals the last active worker to return, mu must be held.
+func (a *autoPool) stop() {
+	last := len(a.quits) - 1
+	close(a.quits[last])
+	a.quits = a.quits[:last]
+}
+
+func (a *autoPool) scale() error {
+	ticker := ClockFrom(a.ctx).NewTicker(a.Interval)
+	defer ticker.Stop()
+	inputDone := a.inputDone
+	for {
+		select {
+		case <-a.ctx.Done():
+			return nil
+		case <-inputDone:
+			inputDone = nil
+		case <-a.exited:
+		case <-ticker.C():
+			a.decide()
+			continue
+		}
+		a.mu.Lock()
+		running := a.running
+		a.mu.Unlock()
+		if inputDone == nil && running == 0 {
+			return nil
+		}
+	}
+}
+
+func (a *autoPool) decide() {
+	e := ScaleEvent{
+		Backlog: len(a.ch.ch),
+		Rate:    float64(atomic.SwapInt64(&a.arrived, 0)) / a.Interval.Seconds(),
+	}
+	if n := atomic.SwapInt64(&a.handled, 0); n > 0 {
+		e.Latency = time.Duration(atomic.SwapInt64(&a.latency, 0) / n)
+	}
+
+	a.mu.Lock()
+	if a.ctx.Err() != nil {
+		a.mu.Unlock()
+		return
+	}
+	e.From = len(a.quits)
+	// workers needed to keep up with the input rate (Little's law)
+	e.To = int(math.Ceil(e.Rate * e.Latency.Seconds()))
+	if e.Backlog > a.Backlog && e.To <= e.From {
+		e.To = e.From + 1
+	}
+	if e.To < e.From {
+		e.To = e.From - 1
+	}
+	if e.To < a.Min {
+		e.To = a.Min
+	}
+	if e.To > a.Max {
+		e.To = a.Max
+	}
+	// removed workers still running count towards Max
+	if room := a.Max - a.running + e.From; e.To > room {
+		e.To = room
+	}
+	for i := e.From; i < e.To; i++ {
+		a.start()
+	}
+	for i := e.To; i < e.From; i++ {
+		a.stop()
+	}
+	a.mu.Unlock()
+	if a.OnScale != nil {
+		a.OnScale(e)
+	}
+}
+
+// autoConsumer consumes the pool channel until the worker is removed.
+type autoConsumer struct {
+	a    *autoPool
+	quit chan struct{}
+}
+
+func (c autoConsumer) Consume(fn ConsumerFunc) error {
+	ctx := c.a.ctx
+	clk := ClockFrom(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.quit:
+			return nil
+		case v, ok := <-c.a.ch.ch:
+			if !ok {
+				return nil
+			}
+			start := clk.Now()
+			err := fn(v)
+			atomic.AddInt64(&c.a.latency, int64(clk.Now().Sub(start)))
+			atomic.AddInt64(&c.a.handled, 1)
+			Release(v, err)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package stream_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stdiopt/stream"
+	"github.com/stdiopt/stream/streamtest"
+	"github.com/stdiopt/stream/strmutil"
+)
+
+func TestAutoWorkers(t *testing.T) {
+	defer streamtest.LeakCheck(t)()
+
+	clk := streamtest.NewClock(time.Time{})
+	ctx := stream.WithClock(context.Background(), clk)
+	events := make(chan stream.ScaleEvent, 100)
+	gate := make(chan struct{})
+	fed := make(chan struct{})
+
+	var out []int
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- stream.RunWithContext(ctx,
+			func(p stream.Proc) error {
+				for i := 0; i < 7; i++ {
+					if err := p.Send(i); err != nil {
+						return err
+					}
+				}
+				// AutoWorkers received the last value once it handed the
+				// previous ones to the pool
+				close(fed)
+				return nil
+			},
+			stream.AutoWorkers(stream.AutoScale{
+				Min:      1,
+				Max:      3,
+				Buffer:   10,
+				Interval: time.Second,
+				OnScale:  func(e stream.ScaleEvent) { events <- e },
+			}, func(p stream.Proc) error {
+				return p.Consume(func(v interface{}) error {
+					<-gate
+					return p.Send(v)
+				})
+			}),
+			strmutil.ToSlice(&out),
+		)
+	}()
+
+	// the backlog stays over 0 once the values are in the pool, every tick of
+	// the scaler sends an event
+	<-fed
+	clk.BlockUntil(1)
+	// advances until the pool reaches a size
+	scaleTo := func(n int) stream.ScaleEvent {
+		t.Helper()
+		for i := 0; i < 100; i++ {
+			clk.Advance(time.Second)
+			e := <-events
+			if e.To > 3 {
+				t.Fatalf("scaled over max: %+v", e)
+			}
+			if e.To == n {
+				return e
+			}
+		}
+		t.Fatalf("no scale to %d workers after 100 ticks", n)
+		return stream.ScaleEvent{}
+	}
+	if e := scaleTo(2); e.From != 1 || e.Backlog == 0 {
+		t.Errorf("\nwant: scale from 1 with backlog\n got: %+v\n", e)
+	}
+	scaleTo(3)
+	for i := 0; i < 3; i++ {
+		if e := scaleTo(3); e.From != 3 {
+			t.Errorf("\nwant: 3 workers\n got: %+v\n", e)
+		}
+	}
+
+	close(gate)
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 7 {
+		t.Errorf("\nwant: %v\n got: %v\n", 7, out)
+	}
+}
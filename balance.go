@@ -0,0 +1,321 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// BalanceStrategy chooses the branch of Balance receiving a message.
+type BalanceStrategy int
+
+// Balance strategies.
+const (
+	// RoundRobin sends to each branch in turn.
+	RoundRobin BalanceStrategy = iota
+	// Weighted sends to each branch proportionally to its weight.
+	Weighted
+	// LeastInFlight sends to the branch consuming less messages.
+	LeastInFlight
+)
+
+func (s BalanceStrategy) String() string {
+	switch s {
+	case RoundRobin:
+		return "round robin"
+	case Weighted:
+		return "weighted"
+	case LeastInFlight:
+		return "least in flight"
+	default:
+		return fmt.Sprintf("BalanceStrategy(%d)", int(s))
+	}
+}
+
+// Balancer configures Balance.
+type Balancer struct {
+	Strategy BalanceStrategy
+	// Weights of the branches for the Weighted strategy, missing weights
+	// default to 1.
+	Weights []int
+	// MaxFailures is the number of consecutive errors returned by the consume
+	// func of a branch before it is ejected, errors are not returned while
+	// there are branches available and the failed messages are released with
+	// the error. If 0 errors are returned as usual.
+	MaxFailures int
+	// EjectFor is the time an ejected branch doesn't receive messages,
+	// defaults to 30 seconds.
+	EjectFor time.Duration
+}
+
+// Balance sends each consumed message to one of the branches chosen by the
+// strategy of b, the messages sent by the branches are merged.
+//
+// A branch that returns stops receiving messages, if every branch is ejected
+// or returned Balance fails.
+//		stream.Balance(stream.Balancer{Strategy: stream.LeastInFlight},
+//			fetchFrom("host-a"),
+//			fetchFrom("host-b"),
+//		)
+func Balance(b Balancer, branches ...ProcFunc) ProcFunc {
+	if len(branches) == 0 {
+		panic("no funcs")
+	}
+	if b.EjectFor <= 0 {
+		b.EjectFor = 30 * time.Second
+	}
+	return composite(func(p Proc) error {
+		if t := topologyFrom(p.Context()); t != nil {
+			return t.add(&Topology{Kind: "balance", Strategy: b.Strategy.String()}, branches...)
+		}
+		eg, ctx := errgroup.WithContext(p.Context())
+		bl := &balancer{
+			Balancer: b,
+			ctx:      ctx,
+			clock:    ClockFrom(ctx),
+			branches: make([]*balanceBranch, len(branches)),
+		}
+		for i, pfn := range branches {
+			br := &balanceBranch{
+				ch:     make(chan interface{}),
+				done:   make(chan struct{}),
+				weight: 1,
+			}
+			if i < len(b.Weights) && b.Weights[i] > 0 {
+				br.weight = b.Weights[i]
+			}
+			bl.branches[i] = br
+			pfn, node := pfn, childNode(ctx, i)
+			eg.Go(func() error {
+				err := runStage(pfn, proc{ctx, balanceConsumer{bl, br}, p}, node)
+				bl.mu.Lock()
+				br.dead = true
+				if err != nil {
+					bl.lastErr = err
+				}
+				bl.mu.Unlock()
+				close(br.done)
+				var nb noBranchError
+				if b.MaxFailures > 0 && !errors.As(err, &nb) && !errors.Is(err, ctx.Err()) {
+					return nil
+				}
+				return err
+			})
+		}
+		eg.Go(func() error {
+			defer func() {
+				for _, br := range bl.branches {
+					close(br.ch)
+				}
+			}()
+			return p.Consume(bl.send)
+		})
+		return eg.Wait()
+	})
+}
+
+type balancer struct {
+	Balancer
+	ctx   context.Context
+	clock Clock
+
+	mu       sync.Mutex
+	branches []*balanceBranch
+	next     int
+	lastErr  error
+}
+
+type balanceBranch struct {
+	ch   chan interface{}
+	done chan struct{}
+
+	// guarded by balancer.mu
+	dead         bool
+	inFlight     int
+	failures     int
+	ejectedUntil time.Time
+	weight       int
+	current      int // smooth weighted round robin state
+}
+
+// send sends v to a branch, choosing again if the branch returns before
+// receiving v.
+func (bl *balancer) send(v interface{}) error {
+	for {
+		brs, err := bl.pick()
+		if err != nil {
+			return err
+		}
+		// v goes to the first of the candidates ready to receive it
+		cases := make([]reflect.SelectCase, 0, 1+2*len(brs))
+		cases = append(cases, reflect.SelectCase{
+			Dir:  reflect.SelectRecv,
+			Chan: reflect.ValueOf(bl.ctx.Done()),
+		})
+		for _, br := range brs {
+			cases = append(cases,
+				reflect.SelectCase{
+					Dir:  reflect.SelectSend,
+					Chan: reflect.ValueOf(br.ch),
+					Send: reflect.ValueOf(&v).Elem(),
+				},
+				reflect.SelectCase{
+					Dir:  reflect.SelectRecv,
+					Chan: reflect.ValueOf(br.done),
+				},
+			)
+		}
+		Retain(v)
+		// counted before the handoff so the branch can't decrement first,
+		// the candidates not chosen are discounted after
+		bl.mu.Lock()
+		for _, br := range brs {
+			br.inFlight++
+		}
+		bl.mu.Unlock()
+		i, _, _ := reflect.Select(cases)
+		bl.mu.Lock()
+		for j, br := range brs {
+			if i%2 == 0 || j != (i-1)/2 {
+				br.inFlight--
+			}
+		}
+		bl.mu.Unlock()
+		if i == 0 {
+			Release(v, bl.ctx.Err())
+			return bl.ctx.Err()
+		}
+		if i%2 == 0 { // branch returned
+			Release(v, nil)
+			continue
+		}
+		return nil
+	}
+}
+
+// pick returns the branches that can receive the next message, there are
+// several only with LeastInFlight when they have the same messages in
+// flight.
+func (bl *balancer) pick() ([]*balanceBranch, error) {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+	now := bl.clock.Now()
+	n := len(bl.branches)
+	var (
+		brs   []*balanceBranch
+		total int
+	)
+	for i := 0; i < n; i++ {
+		br := bl.branches[(bl.next+i)%n]
+		if br.dead || now.Before(br.ejectedUntil) {
+			continue
+		}
+		switch bl.Strategy {
+		case Weighted:
+			br.current += br.weight
+			total += br.weight
+			if len(brs) == 0 || br.current > brs[0].current {
+				brs = []*balanceBranch{br}
+			}
+		case LeastInFlight:
+			switch {
+			case len(brs) == 0 || br.inFlight < brs[0].inFlight:
+				brs = []*balanceBranch{br}
+			case br.inFlight == brs[0].inFlight:
+				brs = append(brs, br)
+			}
+		default:
+			brs = []*balanceBranch{br}
+		}
+		if bl.Strategy == RoundRobin {
+			break
+		}
+	}
+	if len(brs) == 0 {
+		return nil, noBranchError{bl.lastErr}
+	}
+	brs[0].current -= total
+	for i, br := range bl.branches {
+		if br == brs[0] {
+			bl.next = (i + 1) % n
+		}
+	}
+	return brs, nil
+}
+
+// done accounts a message consumed by br, it returns an error if br was
+// ejected and there are no other branches available.
+func (bl *balancer) done(br *balanceBranch, err error) error {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+	br.inFlight--
+	if err == nil {
+		br.failures = 0
+		return nil
+	}
+	bl.lastErr = err
+	br.failures++
+	if bl.MaxFailures == 0 || br.failures < bl.MaxFailures {
+		return nil
+	}
+	br.failures = 0
+	now := bl.clock.Now()
+	br.ejectedUntil = now.Add(bl.EjectFor)
+	for _, b := range bl.branches {
+		if !b.dead && !now.Before(b.ejectedUntil) {
+			return nil
+		}
+	}
+	return noBranchError{err}
+}
+
+// noBranchError is returned when every branch is ejected or returned.
+type noBranchError struct {
+	err error
+}
+
+func (e noBranchError) Error() string {
+	if e.err == nil {
+		return "balance: no branch available"
+	}
+	return "balance: no branch available: " + e.err.Error()
+}
+
+func (e noBranchError) Unwrap() error { return e.err }
+
+// balanceConsumer consumes the messages sent to a branch.
+type balanceConsumer struct {
+	bl *balancer
+	br *balanceBranch
+}
+
+func (c balanceConsumer) Consume(fn ConsumerFunc) error {
+	ctx := c.bl.ctx
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case v, ok := <-c.br.ch:
+			if !ok {
+				return nil
+			}
+			err := fn(v)
+			nbErr := c.bl.done(c.br, err)
+			Release(v, err)
+			if nbErr != nil {
+				return nbErr
+			}
+			if err == nil {
+				continue
+			}
+			if c.bl.MaxFailures == 0 || errors.Is(err, ctx.Err()) {
+				return err
+			}
+		}
+	}
+}
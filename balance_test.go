@@ -0,0 +1,157 @@
+package stream_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stdiopt/stream"
+	"github.com/stdiopt/stream/streamtest"
+	"github.com/stdiopt/stream/strmutil"
+)
+
+func TestBalance(t *testing.T) {
+	streamtest.Table(t,
+		streamtest.Case{
+			Name: "round robin",
+			Proc: stream.Balance(stream.Balancer{},
+				prefix("a"), prefix("b"), prefix("c"),
+			),
+			Input:     []interface{}{1, 2, 3, 4, 5, 6},
+			Want:      []interface{}{"a1", "b2", "c3", "a4", "b5", "c6"},
+			Unordered: true,
+		},
+		streamtest.Case{
+			Name: "weighted",
+			Proc: stream.Balance(stream.Balancer{Strategy: stream.Weighted, Weights: []int{2, 1}},
+				prefix("a"), prefix("b"),
+			),
+			Input:     []interface{}{1, 2, 3, 4, 5, 6},
+			Want:      []interface{}{"a1", "b2", "a3", "a4", "b5", "a6"},
+			Unordered: true,
+		},
+	)
+}
+
+func TestBalanceLeastInFlight(t *testing.T) {
+	slow := func(p stream.Proc) error {
+		return p.Consume(func(v interface{}) error {
+			time.Sleep(5 * time.Millisecond)
+			return p.Send("slow")
+		})
+	}
+	got, err := streamtest.Run(context.Background(),
+		stream.Balance(stream.Balancer{Strategy: stream.LeastInFlight}, slow, prefix("fast")),
+		make([]interface{}, 40)...,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for _, v := range got {
+		if v == "slow" {
+			n++
+		}
+	}
+	if n > 10 {
+		t.Errorf("\nwant: at most 10 messages on the slow branch\n got: %v\n", n)
+	}
+}
+
+func TestBalanceEject(t *testing.T) {
+	defer streamtest.LeakCheck(t)()
+	in := make(chan interface{})
+	errCh := make(chan error, 1)
+	var (
+		mu  sync.Mutex
+		out []string
+	)
+	go func() {
+		errCh <- stream.Run(
+			strmutil.FromChan(in),
+			stream.Balance(stream.Balancer{MaxFailures: 1, EjectFor: time.Hour},
+				func(p stream.Proc) error {
+					return p.Consume(func(v interface{}) error {
+						return fmt.Errorf("failed %v", stream.Unwrap(v))
+					})
+				},
+				unwrapPrefix("b"),
+			),
+			func(p stream.Proc) error {
+				return p.Consume(func(v interface{}) error {
+					mu.Lock()
+					defer mu.Unlock()
+					out = append(out, fmt.Sprint(stream.Unwrap(v)))
+					return nil
+				})
+			},
+		)
+	}()
+
+	acks := make(chan error)
+	for i := 0; i < 5; i++ {
+		in <- stream.WithAck(i, func(err error) { acks <- err })
+		err := <-acks
+		if i == 0 {
+			if want := "failed 0"; err == nil || err.Error() != want {
+				t.Errorf("\nwant: %v\n got: %v\n", want, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	close(in)
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+	streamtest.Equal(t, toInterfaces(out), []interface{}{"b1", "b2", "b3", "b4"})
+}
+
+func TestBalanceNoBranches(t *testing.T) {
+	wantErr := errors.New("failed")
+	tests := []struct {
+		name  string
+		input []interface{}
+	}{
+		{name: "messages after ejection", input: []interface{}{1, 2}},
+		// the only branch is ejected by the last message
+		{name: "ejected on last message", input: []interface{}{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := streamtest.Run(context.Background(),
+				stream.Balance(stream.Balancer{MaxFailures: 1, EjectFor: time.Hour},
+					func(p stream.Proc) error {
+						return p.Consume(func(interface{}) error { return wantErr })
+					},
+				),
+				tt.input...,
+			)
+			if !errors.Is(err, wantErr) {
+				t.Errorf("\nwant: %v\n got: %v\n", wantErr, err)
+			}
+		})
+	}
+}
+
+// unwrapPrefix is prefix for tracked messages, it keeps the Envelope.
+func unwrapPrefix(s string) stream.ProcFunc {
+	return func(p stream.Proc) error {
+		return p.Consume(func(v interface{}) error {
+			return p.Send(stream.Rewrap(v, fmt.Sprint(s, stream.Unwrap(v))))
+		})
+	}
+}
+
+func toInterfaces(ss []string) []interface{} {
+	ret := make([]interface{}, len(ss))
+	for i, s := range ss {
+		ret[i] = s
+	}
+	return ret
+}
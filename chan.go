@@ -21,8 +21,10 @@ func NewChan(ctx context.Context, buffer int) Chan {
 // Send sends v to the underlying channel if context is cancelled it will return
 // the underlying ctx.Err()
 func (c Chan) Send(v interface{}) error {
+	Retain(v)
 	select {
 	case <-c.ctx.Done():
+		Release(v, c.ctx.Err())
 		return c.ctx.Err()
 	case c.ch <- v:
 		return nil
@@ -42,7 +44,9 @@ func (c Chan) Consume(fn ConsumerFunc) error {
 			if !ok {
 				return nil
 			}
-			if err := fn(v); err != nil {
+			err := fn(v)
+			Release(v, err)
+			if err != nil {
 				return err
 			}
 		}
@@ -53,3 +57,7 @@ func (c Chan) Consume(fn ConsumerFunc) error {
 func (c Chan) Close() {
 	close(c.ch)
 }
+
+func (c Chan) queueLen() (int, int) {
+	return len(c.ch), cap(c.ch)
+}
@@ -0,0 +1,295 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Checkpoint keeps source positions and stage state and persists them to a
+// local file so a rerun of the same pipeline can resume where it stopped.
+//
+// Sources read their starting position with Position and wrap each sent
+// message with Track, the position is only committed once the message and
+// every message tracked before it for the same key are acknowledged (see
+// WithAck), so messages in flight when the pipeline stops are processed again
+// on the next run.
+//
+// Tracked messages are sent as stream.Envelopes wrapping the value, so stages
+// consuming from a tracking source must use Unwrap and should send with
+// Rewrap to keep the tracking, declared types (see Typed) are the types of the
+// unwrapped values.
+//
+// A nil *Checkpoint is valid and does nothing.
+type Checkpoint struct {
+	path     string
+	interval time.Duration
+
+	mu      sync.Mutex
+	data    checkpointData
+	pending map[string][]*checkpointPos
+	stalled map[string]bool // keys that stopped committing
+}
+
+// maxPending is the number of unacknowledged messages tracked per key, above
+// it the position of the key stops being committed.
+const maxPending = 1 << 16
+
+type checkpointData struct {
+	Positions map[string]int64           `json:"positions"`
+	State     map[string]json.RawMessage `json:"state"`
+}
+
+type checkpointPos struct {
+	pos  int64
+	done bool
+}
+
+// OpenCheckpoint loads the checkpoint file at path if it exists, the state
+// is saved every interval while running with Checkpointed.
+func OpenCheckpoint(path string, interval time.Duration) (*Checkpoint, error) {
+	c := &Checkpoint{
+		path:     path,
+		interval: interval,
+		data: checkpointData{
+			Positions: map[string]int64{},
+			State:     map[string]json.RawMessage{},
+		},
+		pending: map[string][]*checkpointPos{},
+		stalled: map[string]bool{},
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &c.data); err != nil {
+		return nil, err
+	}
+	if c.data.Positions == nil {
+		c.data.Positions = map[string]int64{}
+	}
+	if c.data.State == nil {
+		c.data.State = map[string]json.RawMessage{}
+	}
+	return c, nil
+}
+
+// Position returns the committed position for key.
+func (c *Checkpoint) Position(key string) (int64, bool) {
+	if c == nil {
+		return 0, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pos, ok := c.data.Positions[key]
+	return pos, ok
+}
+
+// SetPosition commits pos for key.
+func (c *Checkpoint) SetPosition(key string, pos int64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data.Positions[key] = pos
+}
+
+// Track wraps v with an acknowledgement that commits pos as the position of
+// key once v and every message previously tracked for key are acknowledged,
+// pos should be the position to resume from after v.
+//
+// Once a message of key fails, or too many are waiting for acknowledgement,
+// the position of key isn't committed anymore so the next run resumes from
+// the last committed position.
+func (c *Checkpoint) Track(key string, v interface{}, pos int64) interface{} {
+	if c == nil {
+		return v
+	}
+	p := &checkpointPos{pos: pos}
+	c.mu.Lock()
+	switch {
+	case c.stalled[key]:
+	case len(c.pending[key]) >= maxPending:
+		c.stall(key)
+	default:
+		c.pending[key] = append(c.pending[key], p)
+	}
+	c.mu.Unlock()
+
+	return WithAck(v, func(err error) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.stalled[key] {
+			return
+		}
+		if err != nil {
+			c.stall(key)
+			return
+		}
+		p.done = true
+		pending := c.pending[key]
+		for len(pending) > 0 && pending[0].done {
+			c.data.Positions[key] = pending[0].pos
+			pending = pending[1:]
+		}
+		c.pending[key] = pending
+	})
+}
+
+// stall stops committing the position of key, mu must be held.
+func (c *Checkpoint) stall(key string) {
+	c.stalled[key] = true
+	delete(c.pending, key)
+}
+
+// State decodes the saved state of key into v, it returns false if there is
+// no state for key.
+func (c *Checkpoint) State(key string, v interface{}) (bool, error) {
+	if c == nil {
+		return false, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, ok := c.data.State[key]
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(b, v)
+}
+
+// SetState stores the state of key, v is encoded as json.
+func (c *Checkpoint) SetState(key string, v interface{}) error {
+	if c == nil {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data.State[key] = b
+	return nil
+}
+
+// Save writes the checkpoint file.
+func (c *Checkpoint) Save() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	b, err := json.Marshal(c.data)
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // nolint: errcheck
+	if _, err := f.Write(b); err != nil {
+		f.Close() // nolint: errcheck
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), c.path)
+}
+
+// Reset clears the checkpoint and removes the file.
+func (c *Checkpoint) Reset() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	c.data.Positions = map[string]int64{}
+	c.data.State = map[string]json.RawMessage{}
+	c.pending = map[string][]*checkpointPos{}
+	c.stalled = map[string]bool{}
+	c.mu.Unlock()
+
+	err := os.Remove(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+type checkpointKey struct{}
+
+// WithCheckpoint returns a context carrying the Checkpoint c.
+func WithCheckpoint(ctx context.Context, c *Checkpoint) context.Context {
+	return context.WithValue(ctx, checkpointKey{}, c)
+}
+
+// CheckpointFrom returns the Checkpoint carried by ctx or nil.
+func CheckpointFrom(ctx context.Context) *Checkpoint {
+	if ctx == nil {
+		return nil
+	}
+	c, _ := ctx.Value(checkpointKey{}).(*Checkpoint)
+	return c
+}
+
+// Checkpointed runs the ProcFuncs as a Line with the Checkpoint c in the
+// context, saving it periodically and when the Line returns, if the Line
+// finishes without error the checkpoint is reset so the next run starts from
+// the beginning.
+func Checkpointed(c *Checkpoint, pfns ...ProcFunc) ProcFunc {
+	if len(pfns) == 0 {
+		panic("no funcs")
+	}
+	return composite(func(p Proc) error {
+		if t := topologyFrom(p.Context()); t != nil {
+			return t.add(&Topology{Kind: "checkpoint"}, pfns...)
+		}
+		ctx, cancel := context.WithCancel(WithCheckpoint(p.Context(), c))
+		defer cancel()
+
+		eg, ctx := errgroup.WithContext(ctx)
+		done := make(chan struct{})
+		if c != nil && c.interval > 0 {
+			eg.Go(func() error {
+				ticker := ClockFrom(ctx).NewTicker(c.interval)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-done:
+						return nil
+					case <-ctx.Done():
+						return nil
+					case <-ticker.C():
+						if err := c.Save(); err != nil {
+							return err
+						}
+					}
+				}
+			})
+		}
+		eg.Go(func() error {
+			defer close(done)
+			return runLine(proc{ctx, p, p}, pfns)
+		})
+		if err := eg.Wait(); err != nil {
+			if serr := c.Save(); serr != nil {
+				return fmt.Errorf("%w (checkpoint: %v)", err, serr)
+			}
+			return err
+		}
+		return c.Reset()
+	})
+}
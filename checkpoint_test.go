@@ -0,0 +1,72 @@
+package stream_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stdiopt/stream"
+)
+
+func TestCheckpointTrack(t *testing.T) {
+	testError := errors.New("test")
+	tests := []struct {
+		name        string
+		send        int
+		release     func(vs []interface{})
+		wantPending int
+		wantPos     int64
+		wantOK      bool
+	}{
+		{
+			name: "commits acknowledged",
+			send: 3,
+			release: func(vs []interface{}) {
+				stream.Release(vs[0], nil)
+				stream.Release(vs[1], nil)
+			},
+			wantPending: 2,
+			wantPos:     2,
+			wantOK:      true,
+		},
+		{
+			name: "stops committing after a failure",
+			send: 3,
+			release: func(vs []interface{}) {
+				stream.Release(vs[0], testError)
+				stream.Release(vs[1], nil)
+				stream.Release(vs[2], nil)
+			},
+			wantPending: 0,
+		},
+		{
+			name:        "bounds unacknowledged",
+			send:        stream.MaxPending + 10,
+			release:     func([]interface{}) {},
+			wantPending: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ck, err := stream.OpenCheckpoint(filepath.Join(t.TempDir(), "ck.json"), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			vs := make([]interface{}, tt.send)
+			for i := range vs {
+				vs[i] = ck.Track("key", i, int64(i+1))
+			}
+			tt.release(vs)
+			// tracked after a failure or overflow is ignored
+			ck.Track("key", tt.send, int64(tt.send+1))
+
+			if got := stream.PendingLen(ck, "key"); got != tt.wantPending {
+				t.Errorf("\nwant pending: %v\n got pending: %v\n", tt.wantPending, got)
+			}
+			pos, ok := ck.Position("key")
+			if pos != tt.wantPos || ok != tt.wantOK {
+				t.Errorf("\nwant: %v %v\n got: %v %v\n", tt.wantPos, tt.wantOK, pos, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+type collectKey struct{}
+
+type collectorKey struct{}
+
+// WithCollectErrors returns a context where RunWithContext and RunWithReport
+// keep running when stages fail and return a *MultiError with the failures.
+//
+// An error returned by a consume func is collected and the message is released
+// with the error, a stage returning an error is collected and its input is
+// drained. At most max errors are kept, the remaining are only counted.
+func WithCollectErrors(ctx context.Context, max int) context.Context {
+	return context.WithValue(ctx, collectKey{}, max)
+}
+
+// StageError is an error returned by a stage.
+type StageError struct {
+	Stage string
+	Err   error
+}
+
+func (e StageError) Error() string {
+	return e.Stage + ": " + e.Err.Error()
+}
+
+func (e StageError) Unwrap() error {
+	return e.Err
+}
+
+// MultiError is returned by runs with WithCollectErrors.
+type MultiError struct {
+	// Errors are the failures in the order they happened.
+	Errors []StageError
+	// Omitted is the number of failures after the max errors.
+	Omitted int
+	// Canceled are the stages stopped by the context.
+	Canceled []string
+}
+
+func (e *MultiError) Error() string {
+	parts := make([]string, 0, len(e.Errors)+2)
+	for _, err := range e.Errors {
+		parts = append(parts, err.Error())
+	}
+	if e.Omitted > 0 {
+		parts = append(parts, fmt.Sprintf("%d more errors", e.Omitted))
+	}
+	if len(e.Canceled) > 0 {
+		parts = append(parts, "canceled: "+strings.Join(e.Canceled, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Unwrap returns the first error.
+func (e *MultiError) Unwrap() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e.Errors[0]
+}
+
+type collector struct {
+	max int
+
+	mu  sync.Mutex
+	err MultiError
+}
+
+func collectorFrom(ctx context.Context) *collector {
+	c, _ := ctx.Value(collectorKey{}).(*collector)
+	return c
+}
+
+// newCollector returns a collector if ctx was created with WithCollectErrors.
+func newCollector(ctx context.Context) *collector {
+	max, ok := ctx.Value(collectKey{}).(int)
+	if !ok {
+		return nil
+	}
+	return &collector{max: max}
+}
+
+func (c *collector) fail(stage string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.err.Errors) >= c.max {
+		c.err.Omitted++
+		return
+	}
+	c.err.Errors = append(c.err.Errors, StageError{stage, err})
+}
+
+func (c *collector) cancel(stage string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err.Canceled = append(c.err.Canceled, stage)
+}
+
+// result returns the collected errors or err if there are none.
+func (c *collector) result(err error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.err.Errors) == 0 && c.err.Omitted == 0 && len(c.err.Canceled) == 0 {
+		return err
+	}
+	merr := c.err
+	return &merr
+}
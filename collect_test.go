@@ -0,0 +1,109 @@
+package stream_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/stdiopt/stream"
+	"github.com/stdiopt/stream/strmutil"
+)
+
+func TestCollectErrors(t *testing.T) {
+	ctx := stream.WithCollectErrors(context.Background(), 2)
+	var out []int
+	err := stream.RunWithContext(ctx,
+		strmutil.Seq(0, 6, 1),
+		stream.Named("even", func(p stream.Proc) error {
+			return p.Consume(func(v interface{}) error {
+				if v.(int)%2 == 1 {
+					return fmt.Errorf("odd %d", v)
+				}
+				return p.Send(v)
+			})
+		}),
+		strmutil.ToSlice(&out),
+	)
+	var merr *stream.MultiError
+	if !errors.As(err, &merr) {
+		t.Fatalf("\nwant: *stream.MultiError\n got: %v\n", err)
+	}
+	if want := "even: odd 1; even: odd 3; 1 more errors"; merr.Error() != want {
+		t.Errorf("\nwant: %v\n got: %v\n", want, merr.Error())
+	}
+	if want := []int{0, 2, 4}; !reflect.DeepEqual(out, want) {
+		t.Errorf("\nwant: %v\n got: %v\n", want, out)
+	}
+}
+
+func TestCollectErrorsStageFail(t *testing.T) {
+	ctx := stream.WithCollectErrors(context.Background(), 10)
+	var out []int
+	wantErr := errors.New("fail")
+	err := stream.RunWithContext(ctx,
+		strmutil.Seq(0, 6, 1),
+		stream.Named("fail", func(p stream.Proc) error {
+			return p.Consume(func(v interface{}) error {
+				if v == 2 {
+					return wantErr
+				}
+				return p.Send(v)
+			})
+		}),
+		strmutil.ToSlice(&out),
+	)
+	if !errors.Is(err, wantErr) {
+		t.Errorf("\nwant: %v\n got: %v\n", wantErr, err)
+	}
+	// errors from the consume func are collected so the stage never stops
+	if want := "fail: fail"; err == nil || err.Error() != want {
+		t.Errorf("\nwant: %v\n got: %v\n", want, err)
+	}
+	if want := []int{0, 1, 3, 4, 5}; !reflect.DeepEqual(out, want) {
+		t.Errorf("\nwant: %v\n got: %v\n", want, out)
+	}
+
+	err = stream.RunWithContext(ctx,
+		strmutil.Seq(0, 6, 1),
+		stream.Named("source", func(p stream.Proc) error {
+			return wantErr
+		}),
+	)
+	if want := "source: fail"; err == nil || err.Error() != want {
+		t.Errorf("\nwant: %v\n got: %v\n", want, err)
+	}
+}
+
+func TestCollectErrorsCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = stream.WithCollectErrors(ctx, 10)
+	err := stream.RunWithContext(ctx,
+		stream.Named("source", func(p stream.Proc) error {
+			if err := p.Send(1); err != nil {
+				return err
+			}
+			<-p.Context().Done()
+			return p.Context().Err()
+		}),
+		func(p stream.Proc) error {
+			return p.Consume(func(interface{}) error {
+				cancel()
+				return nil
+			})
+		},
+	)
+	var merr *stream.MultiError
+	if !errors.As(err, &merr) {
+		t.Fatalf("\nwant: *stream.MultiError\n got: %v\n", err)
+	}
+	canceled := false
+	for _, s := range merr.Canceled {
+		canceled = canceled || s == "source"
+	}
+	if len(merr.Errors) != 0 || !canceled {
+		t.Errorf("\nwant: source canceled\n got: %v\n", merr)
+	}
+}
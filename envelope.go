@@ -0,0 +1,66 @@
+package stream
+
+// Meta holds the metadata of an Envelope like ids, source offsets, timestamps
+// or trace headers, it is shared by envelopes derived from the same message
+// so it should be treated as read only, use Envelope.With to add keys.
+type Meta map[string]interface{}
+
+// Envelope wraps a value with metadata, stages that understand envelopes
+// process the underlying Value and wrap the result with the same metadata.
+type Envelope struct {
+	Value interface{}
+	Meta  Meta
+
+	acks []*ack
+}
+
+// Wrap returns an Envelope of v with meta.
+func Wrap(v interface{}, meta Meta) Envelope {
+	return Envelope{Value: v, Meta: meta}
+}
+
+// With returns a copy of the envelope with the key added to a copy of Meta.
+func (e Envelope) With(key string, val interface{}) Envelope {
+	meta := make(Meta, len(e.Meta)+1)
+	for k, v := range e.Meta {
+		meta[k] = v
+	}
+	meta[key] = val
+	e.Meta = meta
+	return e
+}
+
+// Unwrap returns the underlying value if v is an Envelope or v otherwise.
+func Unwrap(v interface{}) interface{} {
+	if e, ok := v.(Envelope); ok {
+		return e.Value
+	}
+	return v
+}
+
+// Rewrap wraps v in an Envelope derived from src if src is an Envelope,
+// otherwise or if v is already an Envelope, v is returned as is, the derived
+// envelope keeps the metadata and acknowledgement tracking of src.
+//		return p.Consume(func(v interface{}) error {
+//			res := transform(stream.Unwrap(v))
+//			return p.Send(stream.Rewrap(v, res))
+//		})
+func Rewrap(src, v interface{}) interface{} {
+	e, ok := src.(Envelope)
+	if !ok {
+		return v
+	}
+	if _, ok := v.(Envelope); ok {
+		return v
+	}
+	e.Value = v
+	return e
+}
+
+// MetaOf returns the metadata of v if it is an Envelope or nil otherwise.
+func MetaOf(v interface{}) Meta {
+	if e, ok := v.(Envelope); ok {
+		return e.Meta
+	}
+	return nil
+}
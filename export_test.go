@@ -0,0 +1,34 @@
+package stream
+
+import "context"
+
+// FifoLen returns the items tracked for MaxSkip by c.
+func FifoLen(c *PriorityChan) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.fifo)
+}
+
+// PendingLen returns the messages of key waiting for acknowledgement in c.
+func PendingLen(c *Checkpoint, key string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.pending[key])
+}
+
+// MaxPending is the limit of PendingLen.
+const MaxPending = maxPending
+
+// Link returns the channel tr creates between the stages from and to.
+func Link(ctx context.Context, tr Transport, from, to ProcFunc) interface{} {
+	return tr.link(ctx, from, to)
+}
+
+// BatchLen returns the messages in the current batch of a BatchTransport
+// link.
+func BatchLen(q interface{}) int {
+	c := q.(*batchChan)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.batch)
+}
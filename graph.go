@@ -0,0 +1,305 @@
+package stream
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Graph builds a pipeline from named nodes and explicit edges, unlike Line and
+// Broadcast it can express shapes where branches join again.
+//
+// Values sent by a node are passed to every node it has an edge to and a node
+// with several incoming edges consumes the values of all of them, its input
+// ends when every upstream node returns. Nodes without incoming edges consume
+// the input of the graph and nodes without outgoing edges, other than port
+// edges, send to the output of the graph.
+//		g := stream.NewGraph().
+//			Node("source", source).
+//			Node("enrich", enrich).
+//			Node("audit", audit).
+//			Node("sink", sink).
+//			Edge("source", "enrich", "audit").
+//			Edge("enrich", "sink").
+//			Edge("audit", "sink")
+//		pfn, err := g.Build()
+type Graph struct {
+	nodes []*graphNode
+	index map[string]*graphNode
+	edges []graphEdge
+	errs  []error
+}
+
+type graphNode struct {
+	name string
+	pfn  ProcFunc
+}
+
+type graphEdge struct {
+	from, port, to string
+}
+
+// NewGraph returns an empty Graph.
+func NewGraph() *Graph {
+	return &Graph{index: map[string]*graphNode{}}
+}
+
+// Node adds a node named name running pfns as a Line.
+func (g *Graph) Node(name string, pfns ...ProcFunc) *Graph {
+	switch {
+	case name == "":
+		g.errs = append(g.errs, fmt.Errorf("graph: node without name"))
+		return g
+	case len(pfns) == 0:
+		g.errs = append(g.errs, fmt.Errorf("graph: node %q: no funcs", name))
+		return g
+	case g.index[name] != nil:
+		g.errs = append(g.errs, fmt.Errorf("graph: node %q: duplicated", name))
+		return g
+	}
+	n := &graphNode{name: name, pfn: Line(pfns...)}
+	g.nodes = append(g.nodes, n)
+	g.index[name] = n
+	return g
+}
+
+// Edge adds edges from the node named from to each node in to.
+func (g *Graph) Edge(from string, to ...string) *Graph {
+	for _, t := range to {
+		g.edges = append(g.edges, graphEdge{from, "", t})
+	}
+	return g
+}
+
+// PortEdge adds edges from the output port named port of the node named from
+// to each node in to, see SendTo.
+func (g *Graph) PortEdge(from, port string, to ...string) *Graph {
+	if port == "" {
+		g.errs = append(g.errs, fmt.Errorf("graph: node %q: port without name", from))
+		return g
+	}
+	for _, t := range to {
+		g.edges = append(g.edges, graphEdge{from, port, t})
+	}
+	return g
+}
+
+// Build validates the graph and returns a ProcFunc running it, it fails if
+// edges refer to unknown nodes, if there are cycles, if a node is not
+// connected to any other node or if the ports declared with Outputs and the
+// port edges don't match.
+func (g *Graph) Build() (ProcFunc, error) {
+	if err := g.validate(); err != nil {
+		return nil, err
+	}
+	outs := map[string][]graphEdge{}
+	ins := map[string]int{}
+	for _, e := range g.edges {
+		outs[e.from] = append(outs[e.from], e)
+		ins[e.to]++
+	}
+	nodes := g.nodes
+	edges := g.edges
+	return composite(func(p Proc) error {
+		if t := topologyFrom(p.Context()); t != nil {
+			gt := &Topology{Kind: "graph"}
+			for _, e := range edges {
+				gt.Edges = append(gt.Edges, TopologyEdge{From: e.from, Port: e.port, To: e.to})
+			}
+			for _, n := range nodes {
+				gt.Children = append(gt.Children, describe(n.pfn, n.name))
+			}
+			t.Children = append(t.Children, gt)
+			return nil
+		}
+		eg, ctx := errgroup.WithContext(p.Context())
+
+		inputs := map[string]*graphInput{}
+		var entries []Chan
+		for _, n := range nodes {
+			ch := NewChan(ctx, 0)
+			in := &graphInput{ch: ch, n: ins[n.name]}
+			if in.n == 0 {
+				in.n = 1
+				entries = append(entries, ch)
+			}
+			inputs[n.name] = in
+		}
+		for i, n := range nodes {
+			n, in, node := n, inputs[n.name], childNode(ctx, i) // shadow
+			var main fanoutSender
+			ports := map[string]fanoutSender{}
+			for _, e := range outs[n.name] {
+				if e.port == "" {
+					main = append(main, inputs[e.to].ch)
+					continue
+				}
+				ports[e.port] = append(ports[e.port], inputs[e.to].ch)
+			}
+			var s Sender = p
+			if len(main) > 0 {
+				s = main
+			}
+			nctx := ctx
+			if len(ports) > 0 {
+				senders := make(map[string]Sender, len(ports))
+				for port, fs := range ports {
+					senders[port] = fs
+				}
+				nctx = withPorts(ctx, senders)
+			}
+			eg.Go(func() error {
+				defer func() {
+					for _, e := range outs[n.name] {
+						inputs[e.to].done()
+					}
+				}()
+				return runStage(n.pfn, proc{nctx, in.ch, s}, node)
+			})
+		}
+		eg.Go(func() error {
+			defer func() {
+				for _, n := range nodes {
+					if ins[n.name] == 0 {
+						inputs[n.name].done()
+					}
+				}
+			}()
+			return p.Consume(fanoutSender(entries).Send)
+		})
+		return eg.Wait()
+	}), nil
+}
+
+func (g *Graph) validate() error {
+	if len(g.errs) > 0 {
+		return g.errs[0]
+	}
+	if len(g.nodes) == 0 {
+		return fmt.Errorf("graph: no nodes")
+	}
+	ins := map[string]int{}
+	outs := map[string][]string{}
+	seen := map[graphEdge]bool{}
+	for _, e := range g.edges {
+		from := e.from
+		if e.port != "" {
+			from += ":" + e.port
+		}
+		if g.index[e.from] == nil {
+			return fmt.Errorf("graph: edge %q -> %q: unknown node %q", from, e.to, e.from)
+		}
+		if g.index[e.to] == nil {
+			return fmt.Errorf("graph: edge %q -> %q: unknown node %q", from, e.to, e.to)
+		}
+		if seen[e] {
+			return fmt.Errorf("graph: edge %q -> %q: duplicated", from, e.to)
+		}
+		seen[e] = true
+		ins[e.to]++
+		outs[e.from] = append(outs[e.from], e.to)
+	}
+	if err := g.validatePorts(); err != nil {
+		return err
+	}
+	if len(g.nodes) > 1 {
+		for _, n := range g.nodes {
+			if ins[n.name] == 0 && len(outs[n.name]) == 0 {
+				return fmt.Errorf("graph: node %q: not connected", n.name)
+			}
+		}
+	}
+
+	// Kahn's algorithm, nodes left with incoming edges are part of a cycle
+	queue := []string{}
+	for _, n := range g.nodes {
+		if ins[n.name] == 0 {
+			queue = append(queue, n.name)
+		}
+	}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for _, t := range outs[n] {
+			if ins[t]--; ins[t] == 0 {
+				queue = append(queue, t)
+			}
+		}
+	}
+	cycle := []string{}
+	for name, n := range ins {
+		if n > 0 {
+			cycle = append(cycle, name)
+		}
+	}
+	if len(cycle) > 0 {
+		sort.Strings(cycle)
+		return fmt.Errorf("graph: cycle between nodes %q", cycle)
+	}
+	return nil
+}
+
+// validatePorts checks that every port edge starts from a port declared by
+// its node and that every declared port has an edge.
+func (g *Graph) validatePorts() error {
+	connected := map[string]map[string]bool{}
+	for _, e := range g.edges {
+		if e.port == "" {
+			continue
+		}
+		if connected[e.from] == nil {
+			connected[e.from] = map[string]bool{}
+		}
+		connected[e.from][e.port] = true
+	}
+	for _, n := range g.nodes {
+		declared := map[string]bool{}
+		describe(n.pfn, n.name).outputs(declared)
+		for _, e := range g.edges {
+			if e.from == n.name && e.port != "" && !declared[e.port] {
+				return fmt.Errorf("graph: edge %q -> %q: port %q not declared by %q",
+					e.from+":"+e.port, e.to, e.port, e.from)
+			}
+		}
+		ports := make([]string, 0, len(declared))
+		for port := range declared {
+			ports = append(ports, port)
+		}
+		sort.Strings(ports)
+		for _, port := range ports {
+			if !connected[n.name][port] {
+				return fmt.Errorf("graph: node %q: port %q not connected", n.name, port)
+			}
+		}
+	}
+	return nil
+}
+
+// graphInput closes the input Chan of a node once every upstream is done.
+type graphInput struct {
+	ch Chan
+	mu sync.Mutex
+	n  int
+}
+
+func (in *graphInput) done() {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if in.n--; in.n == 0 {
+		in.ch.Close()
+	}
+}
+
+// fanoutSender sends values to every Chan.
+type fanoutSender []Chan
+
+func (s fanoutSender) Send(v interface{}) error {
+	for _, ch := range s {
+		if err := ch.Send(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
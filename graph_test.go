@@ -0,0 +1,123 @@
+package stream_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stdiopt/stream"
+	"github.com/stdiopt/stream/streamtest"
+	"github.com/stdiopt/stream/strmutil"
+)
+
+func prefix(s string) stream.ProcFunc {
+	return func(p stream.Proc) error {
+		return p.Consume(func(v interface{}) error {
+			return p.Send(fmt.Sprint(s, v))
+		})
+	}
+}
+
+func TestGraph(t *testing.T) {
+	tests := []struct {
+		name    string
+		graph   *stream.Graph
+		input   []interface{}
+		want    []interface{}
+		wantErr string
+	}{
+		{
+			name: "diamond",
+			graph: stream.NewGraph().
+				Node("src", strmutil.FromSlice([]int{1, 2})).
+				Node("a", prefix("a")).
+				Node("b", prefix("b")).
+				Node("sink", prefix(">")).
+				Edge("src", "a", "b").
+				Edge("a", "sink").
+				Edge("b", "sink"),
+			want: []interface{}{">a1", ">a2", ">b1", ">b2"},
+		},
+		{
+			name: "entries consume graph input",
+			graph: stream.NewGraph().
+				Node("a", prefix("a")).
+				Node("b", prefix("b")).
+				Node("c", prefix("c")).
+				Edge("a", "c").
+				Edge("b", "c"),
+			input: []interface{}{1},
+			want:  []interface{}{"ca1", "cb1"},
+		},
+		{
+			name: "two outputs",
+			graph: stream.NewGraph().
+				Node("a", prefix("a")).
+				Node("b", prefix("b")).
+				Node("c", prefix("c")).
+				Edge("a", "b", "c"),
+			input: []interface{}{1},
+			want:  []interface{}{"ba1", "ca1"},
+		},
+		{
+			name:  "single node",
+			graph: stream.NewGraph().Node("a", prefix("a")),
+			input: []interface{}{1},
+			want:  []interface{}{"a1"},
+		},
+		{
+			name: "cycle",
+			graph: stream.NewGraph().
+				Node("a", prefix("a")).
+				Node("b", prefix("b")).
+				Node("c", prefix("c")).
+				Edge("a", "b").
+				Edge("b", "c").
+				Edge("c", "b"),
+			wantErr: `graph: cycle between nodes ["b" "c"]`,
+		},
+		{
+			name: "not connected",
+			graph: stream.NewGraph().
+				Node("a", prefix("a")).
+				Node("b", prefix("b")).
+				Node("c", prefix("c")).
+				Edge("a", "b"),
+			wantErr: `graph: node "c": not connected`,
+		},
+		{
+			name: "unknown node",
+			graph: stream.NewGraph().
+				Node("a", prefix("a")).
+				Edge("a", "b"),
+			wantErr: `graph: edge "a" -> "b": unknown node "b"`,
+		},
+		{
+			name: "duplicated node",
+			graph: stream.NewGraph().
+				Node("a", prefix("a")).
+				Node("a", prefix("a")),
+			wantErr: `graph: node "a": duplicated`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pfn, err := tt.graph.Build()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("\nwant: %v\n got: %v\n", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := streamtest.Run(context.Background(), pfn, tt.input...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			streamtest.EqualUnordered(t, got, tt.want)
+		})
+	}
+}
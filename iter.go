@@ -0,0 +1,100 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Iterator runs a pipeline in the background and exposes the values sent by
+// the last ProcFunc to be pulled by regular Go code.
+//
+//		it := stream.Iter(ctx, strmutil.Seq(0, 10, 1))
+//		defer it.Close()
+//		for {
+//			v, ok := it.Next(ctx)
+//			if !ok {
+//				break
+//			}
+//			fmt.Println(v)
+//		}
+//		if err := it.Err(); err != nil {
+//			...
+//		}
+type Iterator struct {
+	cancel func()
+	ch     Chan
+	done   chan struct{}
+
+	mu      sync.Mutex
+	err     error
+	stopped bool
+}
+
+// Iter starts the ProcFuncs in a go routine as a Line and returns an Iterator
+// to consume the output, the pipeline is cancelled if ctx is cancelled or when
+// Close is called.
+func Iter(ctx context.Context, pfns ...ProcFunc) *Iterator {
+	pfn := Line(pfns...)
+	ctx, cancel := context.WithCancel(ctx)
+	it := &Iterator{
+		cancel: cancel,
+		ch:     NewChan(ctx, 0),
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer close(it.done)
+		defer cancel()
+		defer it.ch.Close()
+		err := pfn(proc{ctx, nil, it.ch})
+
+		it.mu.Lock()
+		it.err = err
+		it.mu.Unlock()
+	}()
+	return it
+}
+
+// Next blocks until the next value is available, it returns false when the
+// pipeline is finished or ctx is done, ctx is only used to stop waiting and it
+// won't cancel the underlying pipeline.
+func (it *Iterator) Next(ctx context.Context) (interface{}, bool) {
+	select {
+	case <-ctx.Done():
+		return nil, false
+	case v, ok := <-it.ch.ch:
+		if !ok {
+			<-it.done
+			return nil, false
+		}
+		Release(v, nil)
+		return v, true
+	}
+}
+
+// Err returns the error that caused the pipeline to stop, it returns nil while
+// the pipeline is running or if it was stopped by Close.
+func (it *Iterator) Err() error {
+	select {
+	case <-it.done:
+	default:
+		return nil
+	}
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	if it.stopped && errors.Is(it.err, context.Canceled) {
+		return nil
+	}
+	return it.err
+}
+
+// Close cancels the pipeline and waits for all ProcFuncs to return.
+func (it *Iterator) Close() error {
+	it.mu.Lock()
+	it.stopped = true
+	it.mu.Unlock()
+
+	it.cancel()
+	<-it.done
+	return it.Err()
+}
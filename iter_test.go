@@ -0,0 +1,89 @@
+package stream_test
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stdiopt/stream"
+)
+
+func TestIter(t *testing.T) {
+	testError := errors.New("test")
+	produce := func(n int, err error) stream.ProcFunc {
+		return func(p stream.Proc) error {
+			for i := 0; i < n; i++ {
+				if err := p.Send(i); err != nil {
+					return err
+				}
+			}
+			return err
+		}
+	}
+	tests := []struct {
+		name     string
+		pfn      stream.ProcFunc
+		take     int
+		wantData []interface{}
+		wantErr  error
+	}{
+		{
+			name:     "consumes all values",
+			pfn:      produce(4, nil),
+			take:     -1,
+			wantData: []interface{}{0, 1, 2, 3},
+		},
+		{
+			name:     "returns pipeline error",
+			pfn:      produce(2, testError),
+			take:     -1,
+			wantData: []interface{}{0, 1},
+			wantErr:  testError,
+		},
+		{
+			name:     "stops early without error",
+			pfn:      produce(1000, nil),
+			take:     2,
+			wantData: []interface{}{0, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := runtime.NumGoroutine()
+			ctx := context.Background()
+
+			it := stream.Iter(ctx, tt.pfn)
+			got := []interface{}{}
+			for tt.take < 0 || len(got) < tt.take {
+				v, ok := it.Next(ctx)
+				if !ok {
+					break
+				}
+				got = append(got, v)
+			}
+			err := it.Close()
+			if want := tt.wantErr; err != want {
+				t.Errorf("\nwant: %v\n got: %v\n", want, err)
+			}
+			if want := len(tt.wantData); len(got) != want {
+				t.Fatalf("\nwant: %v\n got: %v\n", want, len(got))
+			}
+			for i, v := range got {
+				if want := tt.wantData[i]; v != want {
+					t.Errorf("\nwant: %v\n got: %v\n", want, v)
+				}
+			}
+
+			deadline := time.Now().Add(time.Second)
+			for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			if n := runtime.NumGoroutine(); n > before {
+				t.Errorf("leaked go routines\nwant: %v\n got: %v\n", before, n)
+			}
+		})
+	}
+}
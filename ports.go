@@ -0,0 +1,161 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"golang.org/x/sync/errgroup"
+)
+
+type portsKey struct{}
+
+type portsCtx struct {
+	senders map[string]Sender
+	discard bool
+}
+
+// SendTo sends v to the named output port of the Proc, ports are connected by
+// Ports or Graph.PortEdge, sending to a port that isn't connected fails unless
+// the context was created with WithDiscardPorts.
+//		return p.Consume(func(v interface{}) error {
+//			if err := validate(v); err != nil {
+//				return stream.SendTo(p, "invalid", v)
+//			}
+//			return p.Send(v)
+//		})
+func SendTo(p Proc, port string, v interface{}) error {
+	var pc portsCtx
+	if ctx := p.Context(); ctx != nil {
+		pc, _ = ctx.Value(portsKey{}).(portsCtx)
+	}
+	s, ok := pc.senders[port]
+	if !ok {
+		if pc.discard {
+			return nil
+		}
+		return fmt.Errorf("port %q: not connected", port)
+	}
+	return s.Send(v)
+}
+
+// WithDiscardPorts returns a context where SendTo discards the values sent to
+// ports that aren't connected.
+func WithDiscardPorts(ctx context.Context) context.Context {
+	pc, _ := ctx.Value(portsKey{}).(portsCtx)
+	pc.discard = true
+	return context.WithValue(ctx, portsKey{}, pc)
+}
+
+// Outputs declares the output ports the Line of pfns sends to with SendTo,
+// Graph.Build fails if a declared port isn't connected or if a port edge
+// starts from a port that isn't declared.
+//		stream.NewGraph().
+//			Node("validate", stream.Outputs([]string{"invalid"}, validate)).
+//			Node("log", logInvalid).
+//			PortEdge("validate", "invalid", "log")
+func Outputs(ports []string, pfns ...ProcFunc) ProcFunc {
+	pfn := Line(pfns...)
+	ports = append([]string{}, ports...)
+	sort.Strings(ports)
+	return composite(func(p Proc) error {
+		if t := topologyFrom(p.Context()); t != nil {
+			c := describe(pfn, "")
+			c.Outputs = ports
+			t.Children = append(t.Children, c)
+			return nil
+		}
+		return pfn(p)
+	})
+}
+
+// outputs adds to ports the ports declared with Outputs in t that aren't
+// connected by a Ports composition of t.
+func (t *Topology) outputs(ports map[string]bool) {
+	for _, port := range t.Outputs {
+		ports[port] = true
+	}
+	switch t.Kind {
+	case "graph":
+		// checked by its Build
+	case "ports":
+		inner := map[string]bool{}
+		t.Children[0].outputs(inner)
+		for _, c := range t.Children[1:] {
+			delete(inner, c.Port)
+			c.outputs(ports)
+		}
+		for port := range inner {
+			ports[port] = true
+		}
+	default:
+		for _, c := range t.Children {
+			c.outputs(ports)
+		}
+	}
+}
+
+// withPorts returns a context carrying the port senders merged with the ports
+// already in ctx.
+func withPorts(ctx context.Context, senders map[string]Sender) context.Context {
+	pc, _ := ctx.Value(portsKey{}).(portsCtx)
+	merged := make(map[string]Sender, len(pc.senders)+len(senders))
+	for k, s := range pc.senders {
+		merged[k] = s
+	}
+	for k, s := range senders {
+		merged[k] = s
+	}
+	pc.senders = merged
+	return context.WithValue(ctx, portsKey{}, pc)
+}
+
+// Ports runs pfn with its output ports connected to the ProcFuncs in ports,
+// the values sent by the port ProcFuncs are merged into the output of pfn.
+//		stream.Line(
+//			source,
+//			stream.Ports(validate, map[string]stream.ProcFunc{
+//				"invalid": logInvalid,
+//			}),
+//			store,
+//		)
+func Ports(pfn ProcFunc, ports map[string]ProcFunc) ProcFunc {
+	names := make([]string, 0, len(ports))
+	for name := range ports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return composite(func(p Proc) error {
+		if t := topologyFrom(p.Context()); t != nil {
+			pt := &Topology{Kind: "ports", Children: []*Topology{describe(pfn, "")}}
+			for _, name := range names {
+				c := describe(ports[name], "")
+				c.Port = name
+				pt.Children = append(pt.Children, c)
+			}
+			t.Children = append(t.Children, pt)
+			return nil
+		}
+		eg, ctx := errgroup.WithContext(p.Context())
+		senders := make(map[string]Sender, len(names))
+		chs := make([]Chan, 0, len(names))
+		for i, name := range names {
+			ch := NewChan(ctx, 0)
+			port, node := ports[name], childNode(ctx, i+1)
+			eg.Go(func() error {
+				return runStage(port, proc{ctx, ch, p}, node)
+			})
+			senders[name] = ch
+			chs = append(chs, ch)
+		}
+		eg.Go(func() error {
+			defer func() {
+				for _, ch := range chs {
+					ch.Close()
+				}
+			}()
+			return runStage(pfn, proc{withPorts(ctx, senders), p, p}, childNode(ctx, 0))
+		})
+		return eg.Wait()
+	})
+}
@@ -0,0 +1,123 @@
+package stream_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stdiopt/stream"
+	"github.com/stdiopt/stream/streamtest"
+)
+
+func splitOdd(p stream.Proc) error {
+	return p.Consume(func(v interface{}) error {
+		if v.(int)%2 == 1 {
+			return stream.SendTo(p, "odd", v)
+		}
+		return p.Send(v)
+	})
+}
+
+func TestPorts(t *testing.T) {
+	streamtest.Table(t,
+		streamtest.Case{
+			Name: "connected",
+			Proc: stream.Line(
+				stream.Ports(splitOdd, map[string]stream.ProcFunc{
+					"odd": prefix("odd"),
+				}),
+				prefix(">"),
+			),
+			Input:     []interface{}{1, 2, 3, 4},
+			Want:      []interface{}{">odd1", ">2", ">odd3", ">4"},
+			Unordered: true,
+		},
+		streamtest.Case{
+			Name:    "discarded",
+			Proc:    stream.Line(splitOdd, prefix(">")),
+			Context: stream.WithDiscardPorts(context.Background()),
+			Input:   []interface{}{1, 2, 3, 4},
+			Want:    []interface{}{">2", ">4"},
+		},
+	)
+}
+
+func TestPortsNotConnected(t *testing.T) {
+	_, err := streamtest.Run(context.Background(), splitOdd, 1)
+	if want := `port "odd": not connected`; err == nil || err.Error() != want {
+		t.Errorf("\nwant: %v\n got: %v\n", want, err)
+	}
+}
+
+func TestGraphPortEdge(t *testing.T) {
+	pfn, err := stream.NewGraph().
+		Node("split", stream.Outputs([]string{"odd"}, splitOdd)).
+		Node("odd", prefix("odd")).
+		Node("even", prefix("even")).
+		Edge("split", "even").
+		PortEdge("split", "odd", "odd").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := streamtest.Run(context.Background(), pfn, 1, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	streamtest.EqualUnordered(t, got, []interface{}{"odd1", "even2", "odd3"})
+
+	buf := &strings.Builder{}
+	if err := stream.Describe(pfn).WriteDOT(buf); err != nil {
+		t.Fatal(err)
+	}
+	if want := `n2 -> n3 [label="odd"];`; !strings.Contains(buf.String(), want) {
+		t.Errorf("\nwant: %v\n got: %v\n", want, buf.String())
+	}
+}
+
+func TestGraphPortsValidation(t *testing.T) {
+	tests := []struct {
+		name  string
+		graph *stream.Graph
+		want  string
+	}{
+		{
+			name: "port not declared",
+			graph: stream.NewGraph().
+				Node("split", splitOdd).
+				Node("odd", prefix("odd")).
+				PortEdge("split", "odd", "odd"),
+			want: `graph: edge "split:odd" -> "odd": port "odd" not declared by "split"`,
+		},
+		{
+			name: "port not connected",
+			graph: stream.NewGraph().
+				Node("split", stream.Outputs([]string{"odd"}, splitOdd)).
+				Node("even", prefix("even")).
+				Edge("split", "even"),
+			want: `graph: node "split": port "odd" not connected`,
+		},
+		{
+			name: "connected by Ports",
+			graph: stream.NewGraph().
+				Node("split", stream.Ports(
+					stream.Outputs([]string{"odd"}, splitOdd),
+					map[string]stream.ProcFunc{"odd": prefix("odd")},
+				)).
+				Node("even", prefix("even")).
+				Edge("split", "even"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.graph.Build()
+			got := ""
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tt.want {
+				t.Errorf("\nwant: %v\n got: %v\n", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package stream
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Priority configures the order of a PriorityChan.
+type Priority struct {
+	// Func returns the priority of an unwrapped message, higher priorities
+	// are consumed first. If nil the priority is the int value of the Header
+	// key in the Meta of the message.
+	Func func(v interface{}) int
+	// Header is the Meta key with the priority, defaults to "priority".
+	Header string
+	// MaxSkip is the number of messages consumed while a message waits
+	// before it is consumed regardless of its priority, if 0 lower priority
+	// messages might wait while there are higher priority messages.
+	MaxSkip int
+}
+
+func (pr Priority) of(v interface{}) int {
+	if pr.Func != nil {
+		return pr.Func(Unwrap(v))
+	}
+	header := pr.Header
+	if header == "" {
+		header = "priority"
+	}
+	switch n := MetaOf(v)[header].(type) {
+	case int:
+		return n
+	case int64:
+		return int(n)
+	case float64:
+		return int(n)
+	default:
+		return 0
+	}
+}
+
+// PriorityChan is a buffered channel where messages are consumed by priority
+// and in order within the same priority.
+type PriorityChan struct {
+	ctx  context.Context
+	pr   Priority
+	size int
+
+	mu       sync.Mutex
+	items    priorityHeap
+	fifo     []*priorityItem // items by arrival, only kept when MaxSkip > 0
+	seq      int64
+	consumed int64
+	closed   bool
+
+	notEmpty chan struct{}
+	notFull  chan struct{}
+	done     chan struct{}
+}
+
+type priorityItem struct {
+	v        interface{}
+	priority int
+	seq      int64
+	consumed int64 // consumed count when the item was sent
+	index    int   // heap index, -1 once removed
+}
+
+// NewPriorityChan returns a PriorityChan holding up to size messages.
+func NewPriorityChan(ctx context.Context, size int, pr Priority) *PriorityChan {
+	if size <= 0 {
+		size = 1
+	}
+	return &PriorityChan{
+		ctx:      ctx,
+		pr:       pr,
+		size:     size,
+		notEmpty: make(chan struct{}, 1),
+		notFull:  make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+}
+
+// Send adds v to the channel blocking while it's full, if context is
+// cancelled it will return the underlying ctx.Err().
+func (c *PriorityChan) Send(v interface{}) error {
+	Retain(v)
+	it := &priorityItem{v: v, priority: c.pr.of(v)}
+	for {
+		c.mu.Lock()
+		if len(c.items) < c.size {
+			c.seq++
+			it.seq, it.consumed = c.seq, c.consumed
+			heap.Push(&c.items, it)
+			if c.pr.MaxSkip > 0 {
+				c.fifo = append(c.fifo, it)
+			}
+			more := len(c.items) < c.size
+			c.mu.Unlock()
+			signal(c.notEmpty)
+			if more {
+				signal(c.notFull)
+			}
+			return nil
+		}
+		c.mu.Unlock()
+		select {
+		case <-c.ctx.Done():
+			Release(v, c.ctx.Err())
+			return c.ctx.Err()
+		case <-c.notFull:
+		}
+	}
+}
+
+// Consume calls fn with the messages by priority until the channel is closed
+// and empty, the context is cancelled or fn returns an error.
+func (c *PriorityChan) Consume(fn ConsumerFunc) error {
+	for {
+		c.mu.Lock()
+		if len(c.items) == 0 {
+			closed := c.closed
+			c.mu.Unlock()
+			if closed {
+				return nil
+			}
+			select {
+			case <-c.ctx.Done():
+				return c.ctx.Err()
+			case <-c.notEmpty:
+			case <-c.done:
+			}
+			continue
+		}
+		v := c.pop()
+		more := len(c.items) > 0
+		c.mu.Unlock()
+		signal(c.notFull)
+		if more {
+			signal(c.notEmpty)
+		}
+
+		err := fn(v)
+		Release(v, err)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Close closes the channel, the remaining messages are still consumed.
+func (c *PriorityChan) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	close(c.done)
+}
+
+// pop removes the next message, mu must be held.
+//
+// The consumed items stay in fifo until the items sent before them are
+// consumed, the oldest item is consumed after MaxSkip others so there are at
+// most MaxSkip of them.
+func (c *PriorityChan) pop() interface{} {
+	it := c.items[0]
+	if c.pr.MaxSkip > 0 {
+		// drop the items already consumed from the head of fifo
+		for c.fifo[0].index < 0 {
+			c.fifo[0] = nil
+			c.fifo = c.fifo[1:]
+		}
+		if c.consumed-c.fifo[0].consumed >= int64(c.pr.MaxSkip) {
+			it = c.fifo[0]
+		}
+	}
+	heap.Remove(&c.items, it.index)
+	v := it.v
+	it.v, it.index = nil, -1
+	c.consumed++
+	return v
+}
+
+func (c *PriorityChan) queueLen() (int, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.items), c.size
+}
+
+// signal notifies a waiter without blocking.
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// priorityHeap implements heap.Interface ordering items by priority and by
+// sequence within the same priority.
+type priorityHeap []*priorityItem
+
+func (h priorityHeap) Len() int { return len(h) }
+func (h priorityHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h priorityHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *priorityHeap) Push(x interface{}) {
+	it := x.(*priorityItem)
+	it.index = len(*h)
+	*h = append(*h, it)
+}
+
+func (h *priorityHeap) Pop() interface{} {
+	old := *h
+	it := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return it
+}
+
+// PriorityBuffer is a Buffer consumed by priority, see PriorityChan.
+func PriorityBuffer(n int, pr Priority, pfns ...ProcFunc) ProcFunc {
+	return buffer(&Topology{Kind: "buffer", Buffer: n, Queue: "priority"}, func(ctx context.Context) queue {
+		return NewPriorityChan(ctx, n, pr)
+	}, pfns)
+}
+
+// PriorityMerge runs pfns as Broadcast and sends their messages by priority
+// through a PriorityChan holding up to n messages, it's used to merge sources
+// where some messages should overtake the others when the downstream is slow.
+//		stream.PriorityMerge(100, stream.Priority{MaxSkip: 10},
+//			realtime,
+//			backfill,
+//		)
+func PriorityMerge(n int, pr Priority, pfns ...ProcFunc) ProcFunc {
+	if len(pfns) == 0 {
+		panic("no funcs")
+	}
+	bc := Broadcast(pfns...)
+	return composite(func(p Proc) error {
+		if t := topologyFrom(p.Context()); t != nil {
+			return t.add(&Topology{Kind: "broadcast", Buffer: n, Queue: "priority"}, pfns...)
+		}
+		eg, ctx := errgroup.WithContext(p.Context())
+		q := NewPriorityChan(ctx, n, pr)
+		eg.Go(func() error {
+			defer q.Close()
+			return bc(proc{ctx, p, q})
+		})
+		eg.Go(func() error {
+			return q.Consume(p.Send)
+		})
+		return eg.Wait()
+	})
+}
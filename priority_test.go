@@ -0,0 +1,192 @@
+package stream_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stdiopt/stream"
+	"github.com/stdiopt/stream/streamtest"
+	"github.com/stdiopt/stream/strmutil"
+)
+
+func TestPriorityChan(t *testing.T) {
+	byValue := stream.Priority{Func: func(v interface{}) int { return v.(int) / 10 }}
+	tests := []struct {
+		name  string
+		pr    stream.Priority
+		input []interface{}
+		want  []interface{}
+	}{
+		{
+			name:  "consumes by priority",
+			pr:    byValue,
+			input: []interface{}{1, 20, 2, 30, 21},
+			want:  []interface{}{30, 20, 21, 1, 2},
+		},
+		{
+			name: "reads priority from header",
+			input: []interface{}{
+				"a",
+				stream.Wrap("b", stream.Meta{"priority": 2}),
+				stream.Wrap("c", stream.Meta{"priority": 1.0}),
+			},
+			want: []interface{}{"b", "c", "a"},
+		},
+		{
+			name: "custom header",
+			pr:   stream.Priority{Header: "level"},
+			input: []interface{}{
+				stream.Wrap("a", stream.Meta{"priority": 2}),
+				stream.Wrap("b", stream.Meta{"level": 1}),
+			},
+			want: []interface{}{"b", "a"},
+		},
+		{
+			name:  "low priority is consumed after max skip",
+			pr:    stream.Priority{Func: byValue.Func, MaxSkip: 2},
+			input: []interface{}{1, 20, 21, 22, 23, 2},
+			want:  []interface{}{20, 21, 1, 22, 23, 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := stream.NewPriorityChan(context.Background(), len(tt.input), tt.pr)
+			for _, v := range tt.input {
+				if err := ch.Send(v); err != nil {
+					t.Fatal(err)
+				}
+			}
+			ch.Close()
+			var got []interface{}
+			err := ch.Consume(func(v interface{}) error {
+				got = append(got, stream.Unwrap(v))
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("\nwant: %v\n got: %v\n", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPriorityChanFifoBounded(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxSkip int
+		want    int
+	}{
+		{name: "no max skip", maxSkip: 0, want: 0},
+		{name: "max skip", maxSkip: 3, want: 4 + 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer streamtest.LeakCheck(t)()
+			ch := stream.NewPriorityChan(context.Background(), 4, stream.Priority{
+				Func:    func(v interface{}) int { return v.(int) },
+				MaxSkip: tt.maxSkip,
+			})
+			go func() {
+				defer ch.Close()
+				// a low priority message followed by high priority ones
+				if err := ch.Send(0); err != nil {
+					t.Error(err)
+				}
+				for i := 0; i < 1000; i++ {
+					if err := ch.Send(1); err != nil {
+						t.Error(err)
+					}
+				}
+			}()
+			peak := 0
+			err := ch.Consume(func(interface{}) error {
+				if n := stream.FifoLen(ch); n > peak {
+					peak = n
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if peak > tt.want {
+				t.Errorf("\nwant: at most %d tracked items\n got: %d\n", tt.want, peak)
+			}
+		})
+	}
+}
+
+func TestPriorityChanBlocks(t *testing.T) {
+	defer streamtest.LeakCheck(t)()
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := stream.NewPriorityChan(ctx, 1, stream.Priority{})
+	if err := ch.Send(1); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() { done <- ch.Send(2) }()
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("\nwant: %v\n got: %v\n", context.Canceled, err)
+	}
+}
+
+func TestPriorityChanAck(t *testing.T) {
+	var acked []error
+	v := stream.WithAck(1, func(err error) { acked = append(acked, err) })
+	ch := stream.NewPriorityChan(context.Background(), 1, stream.Priority{})
+	if err := ch.Send(v); err != nil {
+		t.Fatal(err)
+	}
+	ch.Close()
+	if len(acked) != 0 {
+		t.Fatalf("acked before being consumed: %v", acked)
+	}
+	if err := ch.Consume(func(interface{}) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if len(acked) != 1 || acked[0] != nil {
+		t.Errorf("\nwant: [<nil>]\n got: %v\n", acked)
+	}
+}
+
+func TestPriorityBuffer(t *testing.T) {
+	streamtest.Table(t,
+		streamtest.Case{
+			Name:      "buffer",
+			Proc:      stream.PriorityBuffer(4, stream.Priority{}, prefix("p")),
+			Input:     []interface{}{1, 2, 3, 4, 5},
+			Want:      []interface{}{"p1", "p2", "p3", "p4", "p5"},
+			Unordered: true,
+		},
+		streamtest.Case{
+			Name: "merge",
+			Proc: stream.PriorityMerge(4, stream.Priority{},
+				strmutil.FromSlice([]interface{}{1, 2}),
+				strmutil.FromSlice([]interface{}{3}),
+			),
+			Want:      []interface{}{1, 2, 3},
+			Unordered: true,
+		},
+	)
+}
+
+func TestPriorityTopology(t *testing.T) {
+	top := stream.Describe(
+		stream.PriorityMerge(8, stream.Priority{}, prefix("a"), prefix("b")),
+		stream.PriorityBuffer(4, stream.Priority{}, prefix("c")),
+	)
+	sb := &strings.Builder{}
+	if err := top.WriteDOT(sb); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"broadcast (8, priority)"`, `"buffer (4, priority)"`} {
+		if !strings.Contains(sb.String(), want) {
+			t.Errorf("\nwant: %s\n got: %s\n", want, sb.String())
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+// Report describes a run of a stream, see RunWithReport.
+type Report struct {
+	Wall   time.Duration
+	Stages []StageReport
+}
+
+// StageReport has the counters of a stage, a stage is a ProcFunc that isn't a
+// composition.
+type StageReport struct {
+	// Name is the stage name or func name, repeated names are numbered.
+	Name string
+	// Instances is the number of times the stage started, i.e: the number of
+	// Workers.
+	Instances int
+	// In and Out are the number of messages consumed and sent.
+	In  int64
+	Out int64
+	// Errors is the number of errors returned by the stage, with
+	// WithCollectErrors it includes the errors returned by its consume func.
+	// Canceled is the number of instances stopped by the context.
+	Errors   int64
+	Canceled int64
+	// QueuePeak is the highest number of messages seen waiting in the
+	// buffered channel the stage consumes from, QueueCap is its capacity.
+	QueuePeak int64
+	QueueCap  int
+	// Busy is the time the stage spent running, excluding the time waiting
+	// to consume or send.
+	Busy time.Duration
+	// Utilization is Busy divided by the wall time of every instance.
+	Utilization float64
+}
+
+// RunWithReport runs the stream like RunWithContext and returns a Report of
+// the run, the report is returned even if the run fails unless the context is
+// from WithCheck and the types don't Check.
+func RunWithReport(ctx context.Context, pfns ...ProcFunc) (*Report, error) {
+	start := time.Now()
+	t, err := runInstrumented(ctx, pfns, checkFrom(ctx))
+	if t == nil {
+		return nil, err
+	}
+	r := &Report{Wall: time.Since(start)}
+	t.walk(func(t *Topology) {
+		s := t.stats
+		if s == nil {
+			return
+		}
+		sr := StageReport{
+			Name:      t.stage,
+			Instances: int(atomic.LoadInt64(&s.instances)),
+			In:        atomic.LoadInt64(&s.in),
+			Out:       atomic.LoadInt64(&s.out),
+			Errors:    atomic.LoadInt64(&s.errors),
+			Canceled:  atomic.LoadInt64(&s.canceled),
+			QueuePeak: atomic.LoadInt64(&s.queuePeak),
+			QueueCap:  int(atomic.LoadInt64(&s.queueCap)),
+			Busy: time.Duration(atomic.LoadInt64(&s.run) -
+				atomic.LoadInt64(&s.send) -
+				atomic.LoadInt64(&s.consume) +
+				atomic.LoadInt64(&s.callback)),
+		}
+		if sr.Busy < 0 {
+			sr.Busy = 0
+		}
+		if total := time.Duration(atomic.LoadInt64(&s.run)); total > 0 {
+			sr.Utilization = float64(sr.Busy) / float64(total)
+		}
+		r.Stages = append(r.Stages, sr)
+	})
+	return r, err
+}
+
+// WriteTable writes the report as a table into w.
+func (r *Report) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "wall: %v\n", r.Wall)
+	fmt.Fprintln(tw, "STAGE\tINSTANCES\tIN\tOUT\tERRORS\tCANCELED\tQUEUE\tBUSY\tUTIL")
+	for _, s := range r.Stages {
+		queue := "-"
+		if s.QueueCap > 0 {
+			queue = fmt.Sprintf("%d/%d", s.QueuePeak, s.QueueCap)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%s\t%v\t%.1f%%\n",
+			s.Name, s.Instances, s.In, s.Out, s.Errors, s.Canceled,
+			queue, s.Busy.Round(time.Microsecond), s.Utilization*100,
+		)
+	}
+	return tw.Flush()
+}
+
+func (r *Report) String() string {
+	sb := &strings.Builder{}
+	r.WriteTable(sb) // nolint: errcheck
+	return sb.String()
+}
+
+// runInstrumented runs pfns as a Line counting the stages of its Topology, if
+// check is true the Topology is nil if the types don't Check.
+func runInstrumented(ctx context.Context, pfns []ProcFunc, check bool) (*Topology, error) {
+	t := Describe(pfns...)
+	if check {
+		if err := t.typeCheck(); err != nil {
+			return nil, err
+		}
+	}
+	names := map[string]int{}
+	t.walk(func(t *Topology) {
+		if t.Kind != "func" {
+			return
+		}
+		t.stats = &stageStats{}
+		t.stage = t.label()
+		if names[t.stage]++; names[t.stage] > 1 {
+			t.stage += "#" + strconv.Itoa(names[t.stage])
+		}
+	})
+	c := newCollector(ctx)
+	if c != nil {
+		ctx = context.WithValue(ctx, collectorKey{}, c)
+	}
+	err := runStage(Line(pfns...), proc{ctx, nil, nil}, t)
+	if c != nil {
+		err = c.result(err)
+	}
+	return t, err
+}
+
+// walk calls fn with t and its descendants in depth first order.
+func (t *Topology) walk(fn func(t *Topology)) {
+	fn(t)
+	for _, c := range t.Children {
+		c.walk(fn)
+	}
+}
+
+// stageStats are the counters of a stage, durations are in nanoseconds.
+type stageStats struct {
+	instances int64
+	in        int64
+	out       int64
+	errors    int64
+	canceled  int64
+	queuePeak int64
+	queueCap  int64
+
+	run      int64 // time running
+	send     int64 // time in Send
+	consume  int64 // time in Consume
+	callback int64 // time in the consume func
+}
+
+type reportNodeKey struct{}
+
+// childNode returns the Topology of the child i of the composition running
+// with ctx, it returns nil if the stream isn't running with a report.
+func childNode(ctx context.Context, i int) *Topology {
+	if ctx == nil {
+		return nil
+	}
+	t, _ := ctx.Value(reportNodeKey{}).(*Topology)
+	if t == nil || i >= len(t.Children) {
+		return nil
+	}
+	return t.Children[i]
+}
+
+// runStage runs pfn described by t, compositions find their children in t
+// and stages are counted.
+func runStage(pfn ProcFunc, p Proc, t *Topology) error {
+	if t == nil {
+		return pfn(p)
+	}
+	ctx := p.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if t.Kind != "func" {
+		return pfn(proc{context.WithValue(ctx, reportNodeKey{}, t), p, p})
+	}
+
+	// the stage might run compositions that aren't in the topology
+	ctx = context.WithValue(ctx, reportNodeKey{}, (*Topology)(nil))
+	s := t.stats
+	c := collectorFrom(ctx)
+	atomic.AddInt64(&s.instances, 1)
+	start := time.Now()
+	err := pfn(stageProc{proc{ctx, p, p}, t.stage, s, c})
+	atomic.AddInt64(&s.run, int64(time.Since(start)))
+	canceled := errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+	switch {
+	case err == nil:
+		return nil
+	case canceled:
+		atomic.AddInt64(&s.canceled, 1)
+	default:
+		atomic.AddInt64(&s.errors, 1)
+	}
+	if c == nil {
+		return err
+	}
+	if canceled {
+		c.cancel(t.stage)
+		return nil
+	}
+	c.fail(t.stage, err)
+	// keeps consuming so the upstream stages aren't blocked
+	return p.Consume(func(v interface{}) error {
+		Release(v, err)
+		return nil
+	})
+}
+
+// stageProc counts the messages of a stage and collects the errors of its
+// consume func if c is not nil.
+type stageProc struct {
+	proc
+	name string
+	s    *stageStats
+	c    *collector
+}
+
+func (p stageProc) Consume(fn ConsumerFunc) error {
+	q, buffered := queueOf(p.Consumer)
+	size := 0
+	if buffered {
+		_, size = q.queueLen()
+		atomic.StoreInt64(&p.s.queueCap, int64(size))
+	}
+	start := time.Now()
+	err := p.proc.Consume(func(v interface{}) error {
+		atomic.AddInt64(&p.s.in, 1)
+		if buffered {
+			// the consumed message counts as waiting, the sender might
+			// have taken its place already
+			n, _ := q.queueLen()
+			if n < size {
+				n++
+			}
+			n64 := int64(n)
+			for {
+				peak := atomic.LoadInt64(&p.s.queuePeak)
+				if n64 <= peak || atomic.CompareAndSwapInt64(&p.s.queuePeak, peak, n64) {
+					break
+				}
+			}
+		}
+		start := time.Now()
+		err := fn(v)
+		atomic.AddInt64(&p.s.callback, int64(time.Since(start)))
+		if err == nil || p.c == nil ||
+			errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return err
+		}
+		atomic.AddInt64(&p.s.errors, 1)
+		p.c.fail(p.name, err)
+		Release(v, err)
+		return nil
+	})
+	atomic.AddInt64(&p.s.consume, int64(time.Since(start)))
+	return err
+}
+
+func (p stageProc) Send(v interface{}) error {
+	start := time.Now()
+	err := p.proc.Send(v)
+	atomic.AddInt64(&p.s.send, int64(time.Since(start)))
+	if err == nil {
+		atomic.AddInt64(&p.s.out, 1)
+	}
+	return err
+}
+
+// bufferedQueue is a queue that reports the messages waiting in it.
+type bufferedQueue interface {
+	queueLen() (n, size int)
+}
+
+// queueOf returns the buffered queue c consumes from.
+func queueOf(c Consumer) (bufferedQueue, bool) {
+	for {
+		switch cc := c.(type) {
+		case proc:
+			c = cc.Consumer
+		case bufferedQueue:
+			_, size := cc.queueLen()
+			return cc, size > 0
+		default:
+			return nil, false
+		}
+	}
+}
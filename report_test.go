@@ -0,0 +1,77 @@
+package stream_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stdiopt/stream"
+	"github.com/stdiopt/stream/strmutil"
+)
+
+func TestRunWithReport(t *testing.T) {
+	var out []string
+	r, err := stream.RunWithReport(context.Background(),
+		strmutil.Seq(0, 10, 1),
+		stream.Workers(2, prefix("w")),
+		stream.Buffer(4, stream.Named("sink", strmutil.ToSlice(&out))),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 10 {
+		t.Fatalf("\nwant: %v\n got: %v\n", 10, len(out))
+	}
+
+	type counts struct {
+		Name      string
+		Instances int
+		In, Out   int64
+		QueueCap  int
+	}
+	want := []counts{
+		{"strmutil.Seq", 1, 0, 10, 0},
+		{"stream_test.prefix", 2, 10, 10, 0},
+		{"sink", 1, 10, 0, 4},
+	}
+	if len(r.Stages) != len(want) {
+		t.Fatalf("\nwant: %v\n got: %v\n", want, r.Stages)
+	}
+	for i, s := range r.Stages {
+		got := counts{s.Name, s.Instances, s.In, s.Out, s.QueueCap}
+		if got != want[i] {
+			t.Errorf("\nwant: %v\n got: %v\n", want[i], got)
+		}
+		if s.QueuePeak > int64(s.QueueCap) {
+			t.Errorf("%s: queue peak %d over capacity %d", s.Name, s.QueuePeak, s.QueueCap)
+		}
+	}
+	if s := r.String(); !strings.Contains(s, "STAGE") || !strings.Contains(s, "sink") {
+		t.Errorf("\nwant: table\n got: %v\n", s)
+	}
+}
+
+func TestRunWithReportError(t *testing.T) {
+	wantErr := errors.New("fail")
+	r, err := stream.RunWithReport(context.Background(),
+		strmutil.Seq(0, 10, 1),
+		func(p stream.Proc) error {
+			return p.Consume(func(v interface{}) error {
+				if v == 3 {
+					return wantErr
+				}
+				return nil
+			})
+		},
+	)
+	if !errors.Is(err, wantErr) {
+		t.Errorf("\nwant: %v\n got: %v\n", wantErr, err)
+	}
+	if got := r.Stages[1].Errors; got != 1 {
+		t.Errorf("\nwant: %v\n got: %v\n", 1, got)
+	}
+	if got := r.Stages[0].Errors + r.Stages[0].Canceled; got != 1 {
+		t.Errorf("\nwant: %v\n got: %v\n", 1, got)
+	}
+}
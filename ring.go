@@ -0,0 +1,197 @@
+package stream
+
+import (
+	"context"
+	"runtime"
+	"sync/atomic"
+)
+
+// ringSpins is the number of times a RingChan yields before blocking.
+const ringSpins = 16
+
+// RingChan is a lock free buffered channel backed by a ring buffer for a
+// single sender and a single consumer, Send must not be called concurrently
+// and neither Consume.
+//
+// The sender and the consumer only block on a channel when the ring is full
+// or empty.
+type RingChan struct {
+	head uint64 // next slot to consume
+	_    [56]byte
+	tail uint64 // next slot to send
+	_    [56]byte
+
+	sendWaiting    int32
+	consumeWaiting int32
+	closed         int32
+
+	ctx      context.Context
+	buf      []interface{}
+	mask     uint64
+	notFull  chan struct{}
+	notEmpty chan struct{}
+}
+
+// NewRingChan returns a RingChan holding size messages rounded up to a power
+// of two.
+func NewRingChan(ctx context.Context, size int) *RingChan {
+	n := 1
+	for n < size {
+		n <<= 1
+	}
+	return &RingChan{
+		ctx:      ctx,
+		buf:      make([]interface{}, n),
+		mask:     uint64(n - 1),
+		notFull:  make(chan struct{}, 1),
+		notEmpty: make(chan struct{}, 1),
+	}
+}
+
+// Send adds v to the ring blocking while it's full, if context is cancelled
+// it will return the underlying ctx.Err().
+func (c *RingChan) Send(v interface{}) error {
+	Retain(v)
+	tail := atomic.LoadUint64(&c.tail)
+	size := uint64(len(c.buf))
+	notFull := func() bool { return tail-atomic.LoadUint64(&c.head) < size }
+	if !notFull() {
+		if err := c.wait(&c.sendWaiting, c.notFull, notFull); err != nil {
+			Release(v, err)
+			return err
+		}
+	}
+	c.buf[tail&c.mask] = v
+	atomic.StoreUint64(&c.tail, tail+1)
+	if atomic.LoadInt32(&c.consumeWaiting) == 1 {
+		signal(c.notEmpty)
+	}
+	return nil
+}
+
+// Consume calls fn with the messages in the ring until it's closed and empty,
+// the context is cancelled or fn returns an error.
+func (c *RingChan) Consume(fn ConsumerFunc) error {
+	for {
+		v, ok, err := c.pop()
+		if err != nil || !ok {
+			return err
+		}
+		err = fn(v)
+		Release(v, err)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Close closes the ring, the remaining messages are still consumed.
+func (c *RingChan) Close() {
+	atomic.StoreInt32(&c.closed, 1)
+	signal(c.notEmpty)
+}
+
+func (c *RingChan) pop() (interface{}, bool, error) {
+	select {
+	case <-c.ctx.Done():
+		return nil, false, c.ctx.Err()
+	default:
+	}
+	head := atomic.LoadUint64(&c.head)
+	ready := func() bool {
+		return head != atomic.LoadUint64(&c.tail) || atomic.LoadInt32(&c.closed) == 1
+	}
+	if !ready() {
+		if err := c.wait(&c.consumeWaiting, c.notEmpty, ready); err != nil {
+			return nil, false, err
+		}
+	}
+	// closed is set after the last send
+	if head == atomic.LoadUint64(&c.tail) {
+		return nil, false, nil
+	}
+	v := c.buf[head&c.mask]
+	c.buf[head&c.mask] = nil
+	atomic.StoreUint64(&c.head, head+1)
+	if atomic.LoadInt32(&c.sendWaiting) == 1 {
+		signal(c.notFull)
+	}
+	return v, true, nil
+}
+
+// wait yields until ready returns true and then blocks on ch, the other side
+// signals ch after it sees waiting set.
+func (c *RingChan) wait(waiting *int32, ch chan struct{}, ready func() bool) error {
+	for i := 0; i < ringSpins; i++ {
+		runtime.Gosched()
+		if ready() {
+			return nil
+		}
+	}
+	atomic.StoreInt32(waiting, 1)
+	defer atomic.StoreInt32(waiting, 0)
+	for !ready() {
+		select {
+		case <-c.ctx.Done():
+			return c.ctx.Err()
+		case <-ch:
+		}
+	}
+	return nil
+}
+
+func (c *RingChan) queueLen() (int, int) {
+	return int(atomic.LoadUint64(&c.tail) - atomic.LoadUint64(&c.head)), len(c.buf)
+}
+
+// RingTransport links stages with a RingChan holding size messages, size
+// defaults to 256.
+//
+// Stages sending or consuming from several goroutines, i.e: Workers or
+// Broadcast, are linked with a Chan of the same size instead, ProcFuncs that
+// aren't compositions are expected to use their Proc from a single goroutine.
+func RingTransport(size int) Transport {
+	if size <= 0 {
+		size = 256
+	}
+	return ringTransport(size)
+}
+
+type ringTransport int
+
+func (tr ringTransport) link(ctx context.Context, from, to ProcFunc) queue {
+	if (from != nil && !singleSender(describe(from, ""))) ||
+		(to != nil && !singleConsumer(describe(to, ""))) {
+		return NewChan(ctx, int(tr))
+	}
+	return NewRingChan(ctx, int(tr))
+}
+
+func (tr ringTransport) describe(t *Topology) {
+	t.Buffer = int(tr)
+	t.Queue = "ring"
+}
+
+// singleSender reports if t sends from a single goroutine.
+func singleSender(t *Topology) bool {
+	switch t.Kind {
+	case "func":
+		return true
+	case "line", "checkpoint", "buffer":
+		return singleSender(t.Children[len(t.Children)-1])
+	default:
+		return false
+	}
+}
+
+// singleConsumer reports if t consumes from a single goroutine.
+func singleConsumer(t *Topology) bool {
+	switch t.Kind {
+	case "func", "buffer":
+		return true
+	case "line", "checkpoint":
+		return singleConsumer(t.Children[0])
+	default:
+		return false
+	}
+}
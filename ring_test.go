@@ -0,0 +1,161 @@
+package stream_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/stdiopt/stream"
+	"github.com/stdiopt/stream/streamtest"
+)
+
+func TestRingChan(t *testing.T) {
+	defer streamtest.LeakCheck(t)()
+	ch := stream.NewRingChan(context.Background(), 3)
+	go func() {
+		defer ch.Close()
+		for i := 0; i < 100; i++ {
+			if err := ch.Send(i); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	var got []interface{}
+	err := ch.Consume(func(v interface{}) error {
+		got = append(got, v)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := make([]interface{}, 100)
+	for i := range want {
+		want[i] = i
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("\nwant: %v\n got: %v\n", want, got)
+	}
+}
+
+func TestRingChanCancel(t *testing.T) {
+	defer streamtest.LeakCheck(t)()
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := stream.NewRingChan(ctx, 1)
+	if err := ch.Send(1); err != nil {
+		t.Fatal(err)
+	}
+	sendErr := make(chan error)
+	go func() { sendErr <- ch.Send(2) }()
+	cancel()
+	if err := <-sendErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("\nwant: %v\n got: %v\n", context.Canceled, err)
+	}
+	err := ch.Consume(func(interface{}) error { return nil })
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("\nwant: %v\n got: %v\n", context.Canceled, err)
+	}
+}
+
+func TestRingTransport(t *testing.T) {
+	input := make([]interface{}, 100)
+	for i := range input {
+		input[i] = i % 10
+	}
+	streamtest.Table(t,
+		streamtest.Case{
+			Name:  "line",
+			Proc:  stream.LineWith(stream.RingTransport(4), prefix("a"), prefix("b")),
+			Input: input,
+			Want:  prefixAll("ba", input),
+		},
+		streamtest.Case{
+			Name: "concurrent senders and consumers",
+			Proc: stream.LineWith(stream.RingTransport(4),
+				stream.Workers(4, prefix("a")),
+				stream.Workers(4, prefix("b")),
+			),
+			Input:     input,
+			Want:      prefixAll("ba", input),
+			Unordered: true,
+		},
+		streamtest.Case{
+			Name:  "buffer",
+			Proc:  stream.BufferWith(stream.RingTransport(8), prefix("b")),
+			Input: input,
+			Want:  prefixAll("b", input),
+		},
+	)
+}
+
+func TestRingTransportLink(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to stream.ProcFunc
+		wantRing bool
+	}{
+		{name: "funcs", from: prefix("a"), to: prefix("b"), wantRing: true},
+		{name: "nil sender", to: prefix("b"), wantRing: true},
+		{
+			name:     "lines",
+			from:     stream.Line(stream.Workers(2, prefix("a")), prefix("a")),
+			to:       stream.Line(prefix("b"), stream.Workers(2, prefix("b"))),
+			wantRing: true,
+		},
+		{name: "buffers", from: stream.Buffer(1, prefix("a")), to: stream.Buffer(1, prefix("b")), wantRing: true},
+		{name: "concurrent senders", from: stream.Workers(2, prefix("a")), to: prefix("b")},
+		{name: "concurrent consumers", from: prefix("a"), to: stream.Workers(2, prefix("b"))},
+		{name: "broadcast", from: stream.Broadcast(prefix("a"), prefix("b")), to: prefix("b")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := stream.Link(context.Background(), stream.RingTransport(4), tt.from, tt.to)
+			if _, got := ch.(*stream.RingChan); got != tt.wantRing {
+				t.Errorf("\nwant ring: %v\n got: %T\n", tt.wantRing, ch)
+			}
+		})
+	}
+}
+
+func prefixAll(s string, vs []interface{}) []interface{} {
+	out := make([]interface{}, len(vs))
+	for i, v := range vs {
+		out[i] = s + string(rune('0'+v.(int)))
+	}
+	return out
+}
+
+func BenchmarkChan(b *testing.B) {
+	type queue interface {
+		stream.Sender
+		stream.Consumer
+		Close()
+	}
+	queues := []struct {
+		name string
+		new  func(ctx context.Context) queue
+	}{
+		{"chan", func(ctx context.Context) queue { return stream.NewChan(ctx, 256) }},
+		{"ring", func(ctx context.Context) queue { return stream.NewRingChan(ctx, 256) }},
+	}
+	for _, q := range queues {
+		q := q
+		b.Run(q.name, func(b *testing.B) {
+			b.ReportAllocs()
+			ch := q.new(context.Background())
+			go func() {
+				defer ch.Close()
+				for i := 0; i < b.N; i++ {
+					if err := ch.Send(i); err != nil {
+						return
+					}
+				}
+			}()
+			err := ch.Consume(func(interface{}) error { return nil })
+			if err != nil {
+				b.Fatal(err)
+			}
+		})
+	}
+}
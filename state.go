@@ -0,0 +1,389 @@
+package stream
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// State is a keyed store used by stateful ProcFuncs, values are encoded as
+// json so Get decodes into a pointer.
+//		st := stream.StateOf(p, "counter")
+//		return p.Consume(func(v interface{}) error {
+//			var n int
+//			if _, err := st.Get(key(v), &n); err != nil {
+//				return err
+//			}
+//			return st.Put(key(v), n+1, time.Hour)
+//		})
+type State interface {
+	// Get decodes the value of key into v, it returns false if the key
+	// doesn't exist or expired.
+	Get(key string, v interface{}) (bool, error)
+	// Put stores v in key, if ttl is greater than 0 the key expires after ttl.
+	Put(key string, v interface{}, ttl time.Duration) error
+	// Delete removes the key.
+	Delete(key string) error
+	// Keys returns the existing keys in order.
+	Keys() ([]string, error)
+}
+
+// StateStore is a State that can be snapshotted and restored, it is placed in
+// the context with WithState.
+type StateStore interface {
+	State
+	Snapshot(w io.Writer) error
+	Restore(r io.Reader) error
+}
+
+type stateKey struct{}
+
+// WithState returns a context carrying the StateStore s.
+func WithState(ctx context.Context, s StateStore) context.Context {
+	return context.WithValue(ctx, stateKey{}, s)
+}
+
+// StateOf returns the State of the store in the Proc context scoped by name,
+// if there is no store in the context a new memory store is returned so
+// StateOf should be called once when the ProcFunc starts.
+func StateOf(p Proc, name string) State {
+	s, ok := p.Context().Value(stateKey{}).(StateStore)
+	if !ok {
+		s = NewMemState()
+	}
+	return scopedState{s, name + "/"}
+}
+
+type scopedState struct {
+	s      State
+	prefix string
+}
+
+func (s scopedState) Get(key string, v interface{}) (bool, error) {
+	return s.s.Get(s.prefix+key, v)
+}
+
+func (s scopedState) Put(key string, v interface{}, ttl time.Duration) error {
+	return s.s.Put(s.prefix+key, v, ttl)
+}
+
+func (s scopedState) Delete(key string) error {
+	return s.s.Delete(s.prefix + key)
+}
+
+func (s scopedState) Keys() ([]string, error) {
+	keys, err := s.s.Keys()
+	if err != nil {
+		return nil, err
+	}
+	ret := []string{}
+	for _, k := range keys {
+		if strings.HasPrefix(k, s.prefix) {
+			ret = append(ret, strings.TrimPrefix(k, s.prefix))
+		}
+	}
+	return ret, nil
+}
+
+type stateEntry struct {
+	Value   json.RawMessage `json:"v"`
+	Expires time.Time       `json:"exp"`
+}
+
+func (e stateEntry) expired(now time.Time) bool {
+	return !e.Expires.IsZero() && !now.Before(e.Expires)
+}
+
+// MemState is an in memory StateStore.
+type MemState struct {
+	// Clock used to expire keys, defaults to RealClock.
+	Clock Clock
+
+	mu      sync.Mutex
+	entries map[string]stateEntry
+}
+
+// NewMemState returns a new memory StateStore.
+func NewMemState() *MemState {
+	return &MemState{
+		Clock:   RealClock,
+		entries: map[string]stateEntry{},
+	}
+}
+
+// Get decodes the value of key into v.
+func (s *MemState) Get(key string, v interface{}) (bool, error) {
+	s.mu.Lock()
+	e, ok := s.entries[key]
+	if ok && e.expired(s.Clock.Now()) {
+		delete(s.entries, key)
+		ok = false
+	}
+	s.mu.Unlock()
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(e.Value, v)
+}
+
+// Put stores v in key.
+func (s *MemState) Put(key string, v interface{}, ttl time.Duration) error {
+	e, err := s.entry(v, ttl)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = e
+	return nil
+}
+
+// Delete removes the key.
+func (s *MemState) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// Keys returns the existing keys in order.
+func (s *MemState) Keys() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.Clock.Now()
+	keys := make([]string, 0, len(s.entries))
+	for k, e := range s.entries {
+		if e.expired(now) {
+			delete(s.entries, k)
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Snapshot writes the existing keys as json into w.
+func (s *MemState) Snapshot(w io.Writer) error {
+	s.mu.Lock()
+	now := s.Clock.Now()
+	entries := make(map[string]stateEntry, len(s.entries))
+	for k, e := range s.entries {
+		if !e.expired(now) {
+			entries[k] = e
+		}
+	}
+	s.mu.Unlock()
+	return json.NewEncoder(w).Encode(entries)
+}
+
+// Restore replaces the existing keys with a snapshot read from r.
+func (s *MemState) Restore(r io.Reader) error {
+	entries := map[string]stateEntry{}
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = entries
+	return nil
+}
+
+func (s *MemState) entry(v interface{}, ttl time.Duration) (stateEntry, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return stateEntry{}, err
+	}
+	e := stateEntry{Value: b}
+	if ttl > 0 {
+		e.Expires = s.Clock.Now().Add(ttl)
+	}
+	return e, nil
+}
+
+// FileState is a StateStore backed by a local append only file, the file is
+// compacted when opened and on Restore.
+type FileState struct {
+	*MemState
+
+	path string
+	fmu  sync.Mutex // held while writing to the file
+	f    *os.File
+}
+
+type stateOp struct {
+	Key     string          `json:"k"`
+	Value   json.RawMessage `json:"v,omitempty"`
+	Expires time.Time       `json:"exp"`
+	Delete  bool            `json:"del,omitempty"`
+}
+
+// OpenFileState opens or creates the state file at path.
+func OpenFileState(path string) (*FileState, error) {
+	s := &FileState{MemState: NewMemState(), path: path}
+	f, err := os.Open(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		err := s.replay(f)
+		f.Close() // nolint: errcheck
+		if err != nil {
+			return nil, err
+		}
+	}
+	s.fmu.Lock()
+	defer s.fmu.Unlock()
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Put stores v in key and appends the operation to the file.
+func (s *FileState) Put(key string, v interface{}, ttl time.Duration) error {
+	e, err := s.entry(v, ttl)
+	if err != nil {
+		return err
+	}
+	s.fmu.Lock()
+	defer s.fmu.Unlock()
+	if err := s.write(stateOp{Key: key, Value: e.Value, Expires: e.Expires}); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = e
+	return nil
+}
+
+// Delete removes the key and appends the operation to the file.
+func (s *FileState) Delete(key string) error {
+	s.fmu.Lock()
+	defer s.fmu.Unlock()
+	if err := s.write(stateOp{Key: key, Delete: true}); err != nil {
+		return err
+	}
+	return s.MemState.Delete(key)
+}
+
+// Restore replaces the existing keys with a snapshot read from r and rewrites
+// the file.
+func (s *FileState) Restore(r io.Reader) error {
+	s.fmu.Lock()
+	defer s.fmu.Unlock()
+	if err := s.MemState.Restore(r); err != nil {
+		return err
+	}
+	return s.compact()
+}
+
+// Close closes the underlying file.
+func (s *FileState) Close() error {
+	s.fmu.Lock()
+	defer s.fmu.Unlock()
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
+
+// Sync commits the file to stable storage.
+func (s *FileState) Sync() error {
+	s.fmu.Lock()
+	defer s.fmu.Unlock()
+	if s.f == nil {
+		return os.ErrClosed
+	}
+	return s.f.Sync()
+}
+
+// write appends op to the file, fmu must be held.
+func (s *FileState) write(op stateOp) error {
+	if s.f == nil {
+		return os.ErrClosed
+	}
+	b, err := json.Marshal(op)
+	if err != nil {
+		return err
+	}
+	_, err = s.f.Write(append(b, '\n'))
+	return err
+}
+
+func (s *FileState) replay(r io.Reader) error {
+	dec := json.NewDecoder(r)
+	for {
+		var op stateOp
+		err := dec.Decode(&op)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if op.Delete {
+			delete(s.entries, op.Key)
+			continue
+		}
+		s.entries[op.Key] = stateEntry{Value: op.Value, Expires: op.Expires}
+	}
+}
+
+// compact rewrites the file with the existing keys, fmu must be held.
+func (s *FileState) compact() error {
+	if s.f != nil {
+		s.f.Close() // nolint: errcheck
+		s.f = nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // nolint: errcheck
+	w := bufio.NewWriter(tmp)
+	s.mu.Lock()
+	now := s.Clock.Now()
+	for k, e := range s.entries {
+		if e.expired(now) {
+			continue
+		}
+		b, err := json.Marshal(stateOp{Key: k, Value: e.Value, Expires: e.Expires})
+		if err != nil {
+			s.mu.Unlock()
+			tmp.Close() // nolint: errcheck
+			return err
+		}
+		w.Write(append(b, '\n')) // nolint: errcheck
+	}
+	s.mu.Unlock()
+	if err := w.Flush(); err != nil {
+		tmp.Close() // nolint: errcheck
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	s.f = f
+	return nil
+}
@@ -0,0 +1,78 @@
+package stream_test
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stdiopt/stream"
+	"github.com/stdiopt/stream/streamtest"
+)
+
+func TestFileState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state")
+	clk := streamtest.NewClock(time.Now())
+
+	s, err := stream.OpenFileState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Clock = clk
+	ctx := stream.WithState(context.Background(), s)
+
+	err = stream.RunWithContext(ctx, func(p stream.Proc) error {
+		st := stream.StateOf(p, "test")
+		if err := st.Put("a", 1, 0); err != nil {
+			return err
+		}
+		if err := st.Put("b", 2, time.Minute); err != nil {
+			return err
+		}
+		if err := st.Put("c", 3, 0); err != nil {
+			return err
+		}
+		return st.Delete("c")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clk.Advance(time.Minute)
+
+	snapshot := &bytes.Buffer{}
+	if err := s.Snapshot(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = stream.OpenFileState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	keys, _ := s.Keys()
+	if want := []string{"test/a", "test/b"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("\nwant: %v\n got: %v\n", want, keys)
+	}
+	s.Clock = clk
+	keys, _ = s.Keys()
+	if want := []string{"test/a"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("\nwant: %v\n got: %v\n", want, keys)
+	}
+
+	if err := s.Put("test/a", 10, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Restore(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if ok, err := s.Get("test/a", &n); !ok || err != nil || n != 1 {
+		t.Errorf("\nwant: %v\n got: %v %v %v\n", 1, n, ok, err)
+	}
+}
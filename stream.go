@@ -66,45 +66,60 @@ func Line(pfns ...ProcFunc) ProcFunc {
 	if len(pfns) == 1 {
 		return pfns[0]
 	}
-	return func(p Proc) error {
-		ctx := p.Context()
-		if ctx == nil {
-			ctx = context.Background()
+	return composite(func(p Proc) error {
+		if t := topologyFrom(p.Context()); t != nil {
+			return t.add(&Topology{Kind: "line"}, pfns...)
 		}
-		eg, ctx := errgroup.WithContext(ctx)
-		last := p // consumer should be nil
-		for i, fn := range pfns {
-			l, fn := last, fn // shadow
-			if i == len(pfns)-1 {
-				// Last one will consume last to P
-				eg.Go(func() error {
-					return fn(proc{ctx, l, p})
-				})
-				break
-			}
-			ch := NewChan(ctx, 0)
-			// Consuming from last and sending to channel
-			np := proc{ctx, l, ch}
+		return runLine(p, pfns)
+	})
+}
+
+// runLine runs pfns as a Line, the ProcFuncs are the children of the running
+// composition.
+func runLine(p Proc, pfns []ProcFunc) error {
+	ctx := p.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if len(pfns) == 1 {
+		return runStage(pfns[0], p, childNode(ctx, 0))
+	}
+	eg, ctx := errgroup.WithContext(ctx)
+	last := p // consumer should be nil
+	for i, fn := range pfns {
+		l, fn, node := last, fn, childNode(ctx, i) // shadow
+		if i == len(pfns)-1 {
+			// Last one will consume last to P
 			eg.Go(func() error {
-				defer ch.Close()
-				return fn(np)
+				return runStage(fn, proc{ctx, l, p}, node)
 			})
-			last = proc{ctx, ch, nil} // don't need a sender here
+			break
 		}
-		return eg.Wait()
+		ch := newLink(ctx, fn, pfns[i+1])
+		// Consuming from last and sending to channel
+		np := proc{ctx, l, ch}
+		eg.Go(func() error {
+			defer ch.Close()
+			return runStage(fn, np, node)
+		})
+		last = proc{ctx, ch, nil} // don't need a sender here
 	}
+	return eg.Wait()
 }
 
 // Broadcast consumes and passes the consumed message to all pfs ProcFuncs.
 func Broadcast(pfns ...ProcFunc) ProcFunc {
-	return func(p Proc) error {
+	return composite(func(p Proc) error {
+		if t := topologyFrom(p.Context()); t != nil {
+			return t.add(&Topology{Kind: "broadcast"}, pfns...)
+		}
 		eg, ctx := errgroup.WithContext(p.Context())
 		chs := make([]Chan, len(pfns))
 		for i, fn := range pfns {
 			ch := NewChan(ctx, 0)
-			fn := fn
+			fn, node := fn, childNode(ctx, i)
 			eg.Go(func() error {
-				return fn(proc{ctx, ch, p})
+				return runStage(fn, proc{ctx, ch, p}, node)
 			})
 			chs[i] = ch
 		}
@@ -124,42 +139,79 @@ func Broadcast(pfns ...ProcFunc) ProcFunc {
 			})
 		})
 		return eg.Wait()
-	}
+	})
 }
 
 // Workers will start N ProcFuncs consuming and sending on same channels.
 func Workers(n int, pfns ...ProcFunc) ProcFunc {
-	pfn := Line(pfns...)
+	if len(pfns) == 0 {
+		panic("no funcs")
+	}
 	if n <= 0 {
 		n = 1
 	}
-	return func(p Proc) error {
+	return composite(func(p Proc) error {
+		if t := topologyFrom(p.Context()); t != nil {
+			return t.add(&Topology{Kind: "workers", Workers: n}, pfns...)
+		}
 		eg, ctx := errgroup.WithContext(p.Context())
 		for i := 0; i < n; i++ {
 			eg.Go(func() error {
-				return pfn(proc{ctx, p, p})
+				return runLine(proc{ctx, p, p}, pfns)
 			})
 		}
 		return eg.Wait()
-	}
+	})
 }
 
 // Buffer will create an extra buffered channel.
 func Buffer(n int, pfns ...ProcFunc) ProcFunc {
-	pfn := Line(pfns...)
-	return func(p Proc) error {
+	return buffer(&Topology{Kind: "buffer", Buffer: n}, func(ctx context.Context) queue {
+		return NewChan(ctx, n)
+	}, pfns)
+}
+
+// BufferWith is a Buffer consuming from a channel created by tr, i.e:
+//		stream.BufferWith(stream.RingTransport(1024), parse, store)
+func BufferWith(tr Transport, pfns ...ProcFunc) ProcFunc {
+	d := &Topology{Kind: "buffer"}
+	tr.describe(d)
+	return buffer(d, func(ctx context.Context) queue {
+		// fed by a single goroutine
+		return tr.link(ctx, nil, pfns[0])
+	}, pfns)
+}
+
+// queue is a channel between the stages of a composition.
+type queue interface {
+	Consumer
+	Sender
+	Close()
+}
+
+// buffer runs pfns consuming from the queue returned by newQueue, the queue
+// is fed with the messages consumed from p.
+func buffer(desc *Topology, newQueue func(ctx context.Context) queue, pfns []ProcFunc) ProcFunc {
+	if len(pfns) == 0 {
+		panic("no funcs")
+	}
+	return composite(func(p Proc) error {
+		if t := topologyFrom(p.Context()); t != nil {
+			d := *desc
+			return t.add(&d, pfns...)
+		}
 		eg, ctx := errgroup.WithContext(p.Context())
 
-		ch := NewChan(ctx, n)
+		ch := newQueue(ctx)
 		eg.Go(func() error {
 			defer ch.Close()
 			return p.Consume(ch.Send)
 		})
 		eg.Go(func() error {
-			return pfn(proc{ctx, ch, p})
+			return runLine(proc{ctx, ch, p}, pfns)
 		})
 		return eg.Wait()
-	}
+	})
 }
 
 // Run will run the stream.
@@ -167,8 +219,19 @@ func Run(pfns ...ProcFunc) error {
 	return RunWithContext(context.Background(), pfns...)
 }
 
-// RunWithContext runs the stream with a context.
+// RunWithContext runs the stream with a context, if the context is from
+// WithCheck the stream doesn't start if the types declared with Typed don't
+// Check.
 func RunWithContext(ctx context.Context, pfns ...ProcFunc) error {
+	if newCollector(ctx) != nil {
+		_, err := runInstrumented(ctx, pfns, checkFrom(ctx))
+		return err
+	}
+	if checkFrom(ctx) {
+		if err := Check(pfns...); err != nil {
+			return err
+		}
+	}
 	pfn := Line(pfns...)
 	return pfn(proc{ctx, nil, nil})
 }
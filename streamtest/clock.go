@@ -0,0 +1,166 @@
+package streamtest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/stdiopt/stream"
+)
+
+// Clock is a fake stream.Clock that only moves when it is advanced manually,
+// it can be placed in the context with stream.WithClock to test time based
+// ProcFuncs without sleeping.
+//		clk := streamtest.NewClock(time.Time{})
+//		ctx := stream.WithClock(context.Background(), clk)
+//		...
+//		clk.BlockUntil(1) // wait for the ProcFunc to create a timer
+//		clk.Advance(time.Second)
+type Clock struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*fakeTimer
+}
+
+// NewClock returns a fake Clock starting at now.
+func NewClock(now time.Time) *Clock {
+	c := &Clock{now: now}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// Now returns the current fake time.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After returns a channel that receives the fake time once it is advanced by d.
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	return c.NewTimer(d).C()
+}
+
+// NewTimer returns a Timer that fires once the clock is advanced by d.
+func (c *Clock) NewTimer(d time.Duration) stream.Timer {
+	t := &fakeTimer{clock: c, ch: make(chan time.Time, 1)}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.add(t, d)
+	return t
+}
+
+// NewTicker returns a Ticker that fires every d the clock is advanced.
+func (c *Clock) NewTicker(d time.Duration) stream.Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	t := &fakeTimer{clock: c, ch: make(chan time.Time, 1), period: d}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.add(t, d)
+	return fakeTicker{t}
+}
+
+// Advance moves the clock forward by d firing any timers and tickers in order.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(c.now.Add(d))
+}
+
+// Set moves the clock to tm firing any timers and tickers in order.
+func (c *Clock) Set(tm time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(tm)
+}
+
+// BlockUntil blocks until there are at least n active timers or tickers.
+func (c *Clock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.waiters) < n {
+		c.cond.Wait()
+	}
+}
+
+func (c *Clock) set(tm time.Time) {
+	for {
+		var next *fakeTimer
+		for _, w := range c.waiters {
+			if w.when.After(tm) {
+				continue
+			}
+			if next == nil || w.when.Before(next.when) {
+				next = w
+			}
+		}
+		if next == nil {
+			break
+		}
+		if next.when.After(c.now) {
+			c.now = next.when
+		}
+		select {
+		case next.ch <- next.when:
+		default:
+		}
+		if next.period > 0 {
+			next.when = next.when.Add(next.period)
+			continue
+		}
+		c.remove(next)
+	}
+	if tm.After(c.now) {
+		c.now = tm
+	}
+}
+
+func (c *Clock) add(t *fakeTimer, d time.Duration) {
+	t.when = c.now.Add(d)
+	c.waiters = append(c.waiters, t)
+	c.cond.Broadcast()
+	if d <= 0 {
+		c.set(c.now)
+	}
+}
+
+func (c *Clock) remove(t *fakeTimer) bool {
+	for i, w := range c.waiters {
+		if w == t {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type fakeTimer struct {
+	clock  *Clock
+	ch     chan time.Time
+	when   time.Time
+	period time.Duration
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.ch }
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	return t.clock.remove(t)
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	active := t.clock.remove(t)
+	t.clock.add(t, d)
+	return active
+}
+
+type fakeTicker struct{ t *fakeTimer }
+
+func (t fakeTicker) C() <-chan time.Time { return t.t.ch }
+
+func (t fakeTicker) Stop() { t.t.Stop() }
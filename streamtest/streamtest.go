@@ -0,0 +1,181 @@
+// Package streamtest provides utilities to test ProcFuncs.
+package streamtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stdiopt/stream"
+	"github.com/stdiopt/stream/strmutil"
+)
+
+var update = flag.Bool("streamtest.update", false, "update streamtest golden files")
+
+// Run feeds inputs into pfn and returns every value sent by pfn and the error
+// returned by the stream.
+func Run(ctx context.Context, pfn stream.ProcFunc, inputs ...interface{}) ([]interface{}, error) {
+	out := []interface{}{}
+	err := stream.RunWithContext(ctx,
+		strmutil.FromSlice(inputs),
+		pfn,
+		strmutil.ToSlice(&out),
+	)
+	return out, err
+}
+
+// Case describes a table driven test case for a ProcFunc.
+type Case struct {
+	Name string
+	// Proc is the ProcFunc under test.
+	Proc stream.ProcFunc
+	// Context used to run the stream, defaults to context.Background.
+	Context context.Context
+	// Input values sent to Proc.
+	Input []interface{}
+	// Want are the expected outputs, ignored if Golden is set.
+	Want []interface{}
+	// WantErr is the expected error, compared with errors.Is.
+	WantErr error
+	// Unordered compares outputs ignoring the order.
+	Unordered bool
+	// Golden is a file name in testdata to compare outputs encoded as json.
+	Golden string
+	// Timeout cancels the stream after the duration, defaults to 5 seconds.
+	Timeout time.Duration
+}
+
+// Table runs each case as a subtest of t and checks for leaked go routines
+// after each run.
+func Table(t *testing.T, cases ...Case) {
+	t.Helper()
+	for _, tt := range cases {
+		tt := tt // shadow
+		t.Run(tt.Name, func(t *testing.T) {
+			t.Helper()
+			defer LeakCheck(t)()
+
+			ctx := tt.Context
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			timeout := tt.Timeout
+			if timeout == 0 {
+				timeout = 5 * time.Second
+			}
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			got, err := Run(ctx, tt.Proc, tt.Input...)
+			if !errors.Is(err, tt.WantErr) {
+				t.Errorf("\nwant err: %v\n got err: %v\n", tt.WantErr, err)
+			}
+			switch {
+			case tt.Golden != "":
+				Golden(t, tt.Golden, got)
+			case tt.Unordered:
+				EqualUnordered(t, got, tt.Want)
+			default:
+				Equal(t, got, tt.Want)
+			}
+		})
+	}
+}
+
+// Equal checks if got and want have the same values in the same order.
+func Equal(t testing.TB, got, want []interface{}) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("\nwant len: %v\n got len: %v\nwant: %v\n got: %v\n", len(want), len(got), want, got)
+		return
+	}
+	for i := range want {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("\nwant[%d]: %#v\n got[%d]: %#v\n", i, want[i], i, got[i])
+		}
+	}
+}
+
+// EqualUnordered checks if got and want have the same values regardless of
+// the order.
+func EqualUnordered(t testing.TB, got, want []interface{}) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("\nwant len: %v\n got len: %v\nwant: %v\n got: %v\n", len(want), len(got), want, got)
+		return
+	}
+	used := make([]bool, len(got))
+	for _, w := range want {
+		found := false
+		for i, g := range got {
+			if used[i] || !reflect.DeepEqual(g, w) {
+				continue
+			}
+			used[i], found = true, true
+			break
+		}
+		if !found {
+			t.Errorf("\nwant: %#v\nnot found in: %v\n", w, got)
+		}
+	}
+}
+
+// LeakCheck records the current number of go routines and returns a func
+// that fails the test if the number is higher when called.
+//		defer streamtest.LeakCheck(t)()
+func LeakCheck(t testing.TB) func() {
+	t.Helper()
+	before := runtime.NumGoroutine()
+	return func() {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		n := runtime.NumGoroutine()
+		for n > before && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+			n = runtime.NumGoroutine()
+		}
+		if n > before {
+			buf := make([]byte, 1<<16)
+			buf = buf[:runtime.Stack(buf, true)]
+			t.Errorf("leaked go routines\nwant: %v\n got: %v\n%s", before, n, buf)
+		}
+	}
+}
+
+// Golden compares the json encoding of v with the file testdata/name, if the
+// test runs with -streamtest.update the file will be written instead.
+func Golden(t testing.TB, name string, v interface{}) {
+	t.Helper()
+	got, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		t.Fatalf("golden: %v", err)
+	}
+	got = append(got, '\n')
+
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("golden: %v", err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("golden: %v", err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("golden: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("golden %s mismatch\nwant:\n%s\n got:\n%s", path, want, got)
+	}
+}
+
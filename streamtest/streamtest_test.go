@@ -0,0 +1,89 @@
+package streamtest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stdiopt/stream"
+	"github.com/stdiopt/stream/streamtest"
+	"github.com/stdiopt/stream/strmutil"
+)
+
+func TestTable(t *testing.T) {
+	testError := errors.New("test")
+	streamtest.Table(t,
+		streamtest.Case{
+			Name:  "field",
+			Proc:  strmutil.Field("a.b"),
+			Input: []interface{}{map[string]interface{}{"a": map[string]interface{}{"b": 1}}},
+			Want:  []interface{}{1},
+		},
+		streamtest.Case{
+			Name:  "unslice",
+			Proc:  strmutil.Unslice(),
+			Input: []interface{}{[]int{1, 2}, []int{3}},
+			Want:  []interface{}{1, 2, 3},
+		},
+		streamtest.Case{
+			Name: "workers unordered",
+			Proc: stream.Workers(4, func(p stream.Proc) error {
+				return p.Consume(func(v interface{}) error {
+					return p.Send(v.(int) * 2)
+				})
+			}),
+			Input:     []interface{}{1, 2, 3, 4},
+			Want:      []interface{}{8, 6, 4, 2},
+			Unordered: true,
+		},
+		streamtest.Case{
+			Name: "error",
+			Proc: func(p stream.Proc) error {
+				return p.Consume(func(v interface{}) error {
+					if v == 2 {
+						return testError
+					}
+					return p.Send(v)
+				})
+			},
+			Input:   []interface{}{1, 2, 3},
+			Want:    []interface{}{1},
+			WantErr: testError,
+		},
+		streamtest.Case{
+			Name:   "golden",
+			Proc:   strmutil.JSONParse(nil),
+			Input:  []interface{}{[]byte(`{"name":"a"} {"name":`), []byte(`"b"}`)},
+			Golden: "jsonparse.golden",
+		},
+	)
+}
+
+func TestClock(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := streamtest.NewClock(start)
+	ctx := stream.WithClock(context.Background(), clk)
+
+	timer := stream.ClockFrom(ctx).NewTimer(time.Second)
+	ticker := stream.ClockFrom(ctx).NewTicker(400 * time.Millisecond)
+	defer ticker.Stop()
+
+	clk.Advance(500 * time.Millisecond)
+	select {
+	case <-timer.C():
+		t.Fatal("timer fired early")
+	case tm := <-ticker.C():
+		if want := start.Add(400 * time.Millisecond); !tm.Equal(want) {
+			t.Errorf("\nwant: %v\n got: %v\n", want, tm)
+		}
+	}
+
+	clk.Advance(500 * time.Millisecond)
+	if tm := <-timer.C(); !tm.Equal(start.Add(time.Second)) {
+		t.Errorf("\nwant: %v\n got: %v\n", start.Add(time.Second), tm)
+	}
+	if want, got := start.Add(time.Second), clk.Now(); !got.Equal(want) {
+		t.Errorf("\nwant: %v\n got: %v\n", want, got)
+	}
+}
@@ -0,0 +1,280 @@
+// Package strmcep detects sequences of events in streams
+package strmcep
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/stdiopt/stream"
+	"github.com/stdiopt/stream/strmutil"
+)
+
+// Step is a step of a Pattern.
+type Step struct {
+	name string
+	pred func(v interface{}) bool
+	min  int
+	max  int // 0 means unbounded
+	not  bool
+}
+
+// Event returns a Step matching one event where pred returns true.
+func Event(name string, pred func(v interface{}) bool) *Step {
+	return &Step{name: name, pred: pred, min: 1, max: 1}
+}
+
+// Not returns a Step that discards the partial match if an event where pred
+// returns true happens between the previous and the next step.
+func Not(name string, pred func(v interface{}) bool) *Step {
+	return &Step{name: name, pred: pred, not: true}
+}
+
+// Times makes the step match exactly n events.
+func (s *Step) Times(n int) *Step {
+	return s.Range(n, n)
+}
+
+// OneOrMore makes the step match one or more events.
+func (s *Step) OneOrMore() *Step {
+	return s.Range(1, 0)
+}
+
+// Range makes the step match at least min and at most max events, if max is
+// 0 there is no upper limit.
+func (s *Step) Range(min, max int) *Step {
+	if s.not {
+		panic("strmcep: repetition on a Not step")
+	}
+	if min < 1 || (max != 0 && max < min) {
+		panic(fmt.Sprintf("strmcep: invalid range %d..%d", min, max))
+	}
+	s.min, s.max = min, max
+	return s
+}
+
+// Pattern is a sequence of steps, events not matching the current step are
+// ignored.
+type Pattern struct {
+	steps     []*Step
+	within    time.Duration
+	maxRuns   int
+	eventTime func(v interface{}) time.Time
+}
+
+// DefaultMaxRuns is the default number of partial matches kept per key.
+const DefaultMaxRuns = 256
+
+// Seq returns a Pattern matching the steps in sequence.
+//		strmcep.Seq(
+//			strmcep.Event("failed", isFailure).Times(3),
+//			strmcep.Not("logout", isLogout),
+//			strmcep.Event("success", isSuccess),
+//		).Within(10 * time.Minute)
+func Seq(steps ...*Step) *Pattern {
+	if len(steps) == 0 {
+		panic("strmcep: no steps")
+	}
+	if steps[0].not || steps[len(steps)-1].not {
+		panic("strmcep: pattern can't start or end with Not")
+	}
+	return &Pattern{steps: steps, maxRuns: DefaultMaxRuns}
+}
+
+// Within discards partial matches when the time between the first and the
+// current event is greater than d.
+func (p *Pattern) Within(d time.Duration) *Pattern {
+	p.within = d
+	return p
+}
+
+// MaxRuns sets the number of partial matches kept per key, the oldest ones are
+// discarded past n. Repeated steps start a partial match on every event so
+// without Within they would grow without bound, n defaults to DefaultMaxRuns.
+func (p *Pattern) MaxRuns(n int) *Pattern {
+	if n < 1 {
+		panic(fmt.Sprintf("strmcep: invalid max runs %d", n))
+	}
+	p.maxRuns = n
+	return p
+}
+
+// EventTime sets the func that returns the time of an event, by default the
+// time the event is consumed is used.
+func (p *Pattern) EventTime(fn func(v interface{}) time.Time) *Pattern {
+	p.eventTime = fn
+	return p
+}
+
+// Match is sent when a Pattern is matched.
+type Match struct {
+	Key    interface{}
+	Start  time.Time
+	End    time.Time
+	Events []MatchEvent
+}
+
+// MatchEvent is an event of a Match.
+type MatchEvent struct {
+	Step  string
+	Value interface{}
+}
+
+// Step returns the values matched by the step name.
+func (m Match) Step(name string) []interface{} {
+	var ret []interface{}
+	for _, e := range m.Events {
+		if e.Step == name {
+			ret = append(ret, e.Value)
+		}
+	}
+	return ret
+}
+
+type run struct {
+	step   int // index of the current positive step
+	count  int // events matched in the current step
+	start  time.Time
+	events []MatchEvent
+}
+
+// sweepEvery is the number of events between sweeps of expired runs.
+const sweepEvery = 1024
+
+// Detect consumes events and sends a Match each time the pattern p is matched
+// by events with the same key, the key is fetched from the field f as in
+// strmutil.FieldOf, once a key matches its other partial matches are
+// discarded. Keys must be comparable, a key that isn't fails with an error.
+func Detect(f string, p *Pattern) stream.ProcFunc {
+	return func(proc stream.Proc) error {
+		clk := stream.ClockFrom(proc.Context())
+		runs := map[interface{}][]*run{}
+		n := 0
+		return proc.Consume(func(v interface{}) error {
+			v = stream.Unwrap(v)
+			key, err := strmutil.FieldOf(v, f)
+			if err != nil {
+				return err
+			}
+			if key != nil && !reflect.TypeOf(key).Comparable() {
+				return fmt.Errorf("invalid key: %T is not comparable", key)
+			}
+			now := clk.Now()
+			if p.eventTime != nil {
+				now = p.eventTime(v)
+			}
+			if n++; n%sweepEvery == 0 {
+				for k, rs := range runs {
+					if rs = p.expire(rs, now); len(rs) == 0 {
+						delete(runs, k)
+					} else {
+						runs[k] = rs
+					}
+				}
+			}
+
+			rs, m := p.advance(p.expire(runs[key], now), v, now)
+			if m == nil {
+				if len(rs) > p.maxRuns {
+					rs = rs[len(rs)-p.maxRuns:]
+				}
+				if len(rs) == 0 {
+					delete(runs, key)
+				} else {
+					runs[key] = rs
+				}
+				return nil
+			}
+			delete(runs, key)
+			m.Key = key
+			return proc.Send(*m)
+		})
+	}
+}
+
+func (p *Pattern) expire(rs []*run, now time.Time) []*run {
+	if p.within <= 0 {
+		return rs
+	}
+	ret := rs[:0]
+	for _, r := range rs {
+		if now.Sub(r.start) <= p.within {
+			ret = append(ret, r)
+		}
+	}
+	return ret
+}
+
+// advance feeds v into the runs and returns the remaining runs or the first
+// completed match.
+func (p *Pattern) advance(rs []*run, v interface{}, now time.Time) ([]*run, *Match) {
+	next := []*run{}
+	for _, r := range rs {
+		if p.negated(r, v) {
+			continue
+		}
+		s := p.steps[r.step]
+		if !s.pred(v) {
+			next = append(next, r)
+			continue
+		}
+		r.events = append(r.events, MatchEvent{s.name, v})
+		r.count++
+		if r.count < s.min {
+			next = append(next, r)
+			continue
+		}
+		if s.max == 0 || r.count < s.max {
+			// can take more events in the same step so it keeps a copy
+			// that stays in the current step
+			cp := *r
+			cp.events = append([]MatchEvent{}, r.events...)
+			next = append(next, &cp)
+		}
+		r.step, r.count = p.nextStep(r.step), 0
+		if r.step == len(p.steps) {
+			return nil, &Match{Start: r.start, End: now, Events: r.events}
+		}
+		next = append(next, r)
+	}
+
+	first := p.steps[0]
+	if !first.pred(v) {
+		return next, nil
+	}
+	r := &run{start: now, count: 1, events: []MatchEvent{{first.name, v}}}
+	if r.count < first.min {
+		return append(next, r), nil
+	}
+	if first.max == 0 || r.count < first.max {
+		cp := *r
+		cp.events = append([]MatchEvent{}, r.events...)
+		next = append(next, &cp)
+	}
+	r.step, r.count = p.nextStep(0), 0
+	if r.step == len(p.steps) {
+		return nil, &Match{Start: now, End: now, Events: r.events}
+	}
+	return append(next, r), nil
+}
+
+// nextStep returns the index of the positive step after i.
+func (p *Pattern) nextStep(i int) int {
+	for i++; i < len(p.steps) && p.steps[i].not; i++ {
+	}
+	return i
+}
+
+// negated returns true if v matches a Not step before the current step of r,
+// Not steps are only checked once the previous step was matched.
+func (p *Pattern) negated(r *run, v interface{}) bool {
+	if r.count > 0 {
+		return false
+	}
+	for i := r.step - 1; i >= 0 && p.steps[i].not; i-- {
+		if p.steps[i].pred(v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package strmcep_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stdiopt/stream"
+	"github.com/stdiopt/stream/streamtest"
+	"github.com/stdiopt/stream/strmcep"
+)
+
+type login struct {
+	User string
+	OK   bool
+	Min  int
+}
+
+func TestDetect(t *testing.T) {
+	t0 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	failed := func(v interface{}) bool { return !v.(login).OK && v.(login).Min >= 0 }
+	success := func(v interface{}) bool { return v.(login).OK }
+	eventTime := func(v interface{}) time.Time {
+		return t0.Add(time.Duration(v.(login).Min) * time.Minute)
+	}
+	format := func(p stream.Proc) error {
+		return p.Consume(func(v interface{}) error {
+			m := v.(strmcep.Match)
+			return p.Send(fmt.Sprintf("%v %v %d", m.Key, m.End.Sub(m.Start), len(m.Step("failed"))))
+		})
+	}
+
+	streamtest.Table(t,
+		streamtest.Case{
+			Name: "repetition within time",
+			Proc: stream.Line(
+				strmcep.Detect("User", strmcep.Seq(
+					strmcep.Event("failed", failed).Times(3),
+					strmcep.Event("success", success),
+				).Within(10*time.Minute).EventTime(eventTime)),
+				format,
+			),
+			Input: []interface{}{
+				login{"a", false, 0},
+				login{"b", false, 0},
+				login{"a", false, 1},
+				login{"b", false, 1},
+				login{"a", false, 2},
+				login{"a", false, 3},
+				login{"b", false, 11},
+				login{"a", true, 4},
+				login{"b", true, 12},
+			},
+			Want: []interface{}{
+				"a 4m0s 3",
+			},
+		},
+		streamtest.Case{
+			Name: "negation",
+			Proc: stream.Line(
+				strmcep.Detect("User", strmcep.Seq(
+					strmcep.Event("failed", failed).OneOrMore(),
+					strmcep.Not("reset", func(v interface{}) bool { return v.(login).Min < 0 }),
+					strmcep.Event("success", success),
+				).EventTime(eventTime)),
+				format,
+			),
+			Input: []interface{}{
+				login{"a", false, 0},
+				login{"a", false, -1},
+				login{"a", true, 2},
+				login{"b", false, 0},
+				login{"b", false, 1},
+				login{"b", true, 2},
+			},
+			Want: []interface{}{
+				"b 2m0s 2",
+			},
+		},
+		streamtest.Case{
+			Name: "max runs",
+			Proc: stream.Line(
+				strmcep.Detect("User", strmcep.Seq(
+					strmcep.Event("failed", failed).OneOrMore(),
+					strmcep.Event("success", success),
+				).MaxRuns(2).EventTime(eventTime)),
+				format,
+			),
+			Input: []interface{}{
+				login{"a", false, 0},
+				login{"a", false, 1},
+				login{"a", false, 2},
+				login{"a", true, 3},
+			},
+			// the partial matches starting at 0 and 1 were discarded
+			Want: []interface{}{
+				"a 1m0s 1",
+			},
+		},
+	)
+}
+
+func TestDetectRunsBounded(t *testing.T) {
+	input := make([]interface{}, 10000)
+	for i := range input {
+		input[i] = login{"a", false, i}
+	}
+	input = append(input, login{"a", true, len(input)})
+	// without Within every failure starts a partial match
+	got, err := streamtest.Run(context.Background(),
+		strmcep.Detect("User", strmcep.Seq(
+			strmcep.Event("failed", func(v interface{}) bool { return !v.(login).OK }).OneOrMore(),
+			strmcep.Event("success", func(v interface{}) bool { return v.(login).OK }),
+		)),
+		input...,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("\nwant: 1 match\n got: %v\n", len(got))
+	}
+	if n := len(got[0].(strmcep.Match).Step("failed")); n > strmcep.DefaultMaxRuns {
+		t.Errorf("\nwant: at most %v events\n got: %v\n", strmcep.DefaultMaxRuns, n)
+	}
+}
+
+func TestDetectNotComparable(t *testing.T) {
+	type event struct{ Tags []string }
+	_, err := streamtest.Run(context.Background(),
+		strmcep.Detect("Tags", strmcep.Seq(
+			strmcep.Event("any", func(interface{}) bool { return true }),
+		)),
+		event{[]string{"a"}},
+	)
+	if want := "invalid key: []string is not comparable"; err == nil || err.Error() != want {
+		t.Errorf("\nwant: %v\n got: %v\n", want, err)
+	}
+}
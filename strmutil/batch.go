@@ -0,0 +1,175 @@
+package strmutil
+
+import (
+	"context"
+	"time"
+
+	"github.com/stdiopt/stream"
+	"golang.org/x/sync/errgroup"
+)
+
+type batchOptions struct {
+	size    int
+	bytes   int
+	sizeFn  func(v interface{}) int
+	latency time.Duration
+}
+
+// BatchOptFunc configures a Batch.
+type BatchOptFunc func(o *batchOptions)
+
+// BatchSize flushes the batch when it reaches n elements.
+func BatchSize(n int) BatchOptFunc {
+	return func(o *batchOptions) {
+		o.size = n
+	}
+}
+
+// BatchBytes flushes the batch before its size reaches more than n bytes, the
+// size of each element is calculated by fn, if fn is nil the length of []byte
+// and string elements is used and any other type is counted as 0.
+func BatchBytes(n int, fn func(v interface{}) int) BatchOptFunc {
+	if fn == nil {
+		fn = byteSize
+	}
+	return func(o *batchOptions) {
+		o.bytes = n
+		o.sizeFn = fn
+	}
+}
+
+// BatchLatency flushes the batch when d has passed since the first element of
+// the batch was consumed.
+func BatchLatency(d time.Duration) BatchOptFunc {
+	return func(o *batchOptions) {
+		o.latency = d
+	}
+}
+
+// Batch groups consumed values and sends them as []interface{} when the first
+// of the configured limits is reached, the remaining values are sent when the
+// stream ends, if the values are tracked with stream.WithAck the batch is
+// sent as a stream.Envelope joining their acknowledgements.
+//		strmutil.Batch(
+//			strmutil.BatchSize(1000),
+//			strmutil.BatchBytes(1<<20, nil),
+//			strmutil.BatchLatency(time.Second),
+//		)
+func Batch(opts ...BatchOptFunc) ProcFunc {
+	o := batchOptions{}
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return func(p Proc) error {
+		ctx, cancel := context.WithCancel(p.Context())
+		defer cancel()
+		clk := stream.ClockFrom(ctx)
+
+		in, wait := consumeChan(ctx, p)
+		defer wait() // nolint: errcheck
+
+		var (
+			batch  []interface{}
+			bytes  int
+			timer  stream.Timer
+			timerC <-chan time.Time
+		)
+		flush := func() error {
+			if timer != nil {
+				timer.Stop()
+				timer, timerC = nil, nil
+			}
+			if len(batch) == 0 {
+				return nil
+			}
+			b := batch
+			batch, bytes = nil, 0
+			err := p.Send(stream.Join(b, b...))
+			releaseAll(b, err)
+			return err
+		}
+		for {
+			select {
+			case <-timerC:
+				if err := flush(); err != nil {
+					return err
+				}
+			case v, ok := <-in:
+				if !ok {
+					if err := wait(); err != nil {
+						releaseAll(batch, err)
+						return err
+					}
+					return flush()
+				}
+				sz := 0
+				if o.bytes > 0 {
+					sz = o.sizeFn(v)
+					if len(batch) > 0 && bytes+sz > o.bytes {
+						if err := flush(); err != nil {
+							return err
+						}
+					}
+				}
+				batch = append(batch, v)
+				bytes += sz
+				if len(batch) == 1 && o.latency > 0 {
+					timer = clk.NewTimer(o.latency)
+					timerC = timer.C()
+				}
+				if (o.size > 0 && len(batch) >= o.size) ||
+					(o.bytes > 0 && bytes >= o.bytes) {
+					if err := flush(); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+}
+
+func byteSize(v interface{}) int {
+	switch v := v.(type) {
+	case []byte:
+		return len(v)
+	case string:
+		return len(v)
+	default:
+		return 0
+	}
+}
+
+// consumeChan consumes p in a go routine and returns a channel receiving the
+// consumed values, the channel is closed once the consumer returns. wait stops
+// the consumer if it's still running and returns its error, it can be called
+// more than once so callers returning early defer it.
+// Values received from the channel are retained and must be released with
+// stream.Release.
+func consumeChan(ctx context.Context, p Proc) (<-chan interface{}, func() error) {
+	ctx, cancel := context.WithCancel(ctx)
+	ch := make(chan interface{})
+	var eg errgroup.Group
+	eg.Go(func() error {
+		defer close(ch)
+		return p.Consume(func(v interface{}) error {
+			stream.Retain(v)
+			select {
+			case <-ctx.Done():
+				stream.Release(v, ctx.Err())
+				return ctx.Err()
+			case ch <- v:
+				return nil
+			}
+		})
+	})
+	return ch, func() error {
+		cancel()
+		return eg.Wait()
+	}
+}
+
+func releaseAll(vs []interface{}, err error) {
+	for _, v := range vs {
+		stream.Release(v, err)
+	}
+}
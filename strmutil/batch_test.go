@@ -0,0 +1,105 @@
+package strmutil_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stdiopt/stream"
+	"github.com/stdiopt/stream/streamtest"
+	"github.com/stdiopt/stream/strmutil"
+)
+
+func TestBatch(t *testing.T) {
+	streamtest.Table(t,
+		streamtest.Case{
+			Name:  "flush by size",
+			Proc:  strmutil.Batch(strmutil.BatchSize(2)),
+			Input: []interface{}{1, 2, 3, 4, 5},
+			Want: []interface{}{
+				[]interface{}{1, 2},
+				[]interface{}{3, 4},
+				[]interface{}{5},
+			},
+		},
+		streamtest.Case{
+			Name:  "flush by bytes",
+			Proc:  strmutil.Batch(strmutil.BatchBytes(4, nil)),
+			Input: []interface{}{"ab", "c", "de", "fghij", "k"},
+			Want: []interface{}{
+				[]interface{}{"ab", "c"},
+				[]interface{}{"de"},
+				[]interface{}{"fghij"},
+				[]interface{}{"k"},
+			},
+		},
+	)
+}
+
+func TestBatchLatency(t *testing.T) {
+	defer streamtest.LeakCheck(t)()
+
+	clk := streamtest.NewClock(time.Time{})
+	ctx := stream.WithClock(context.Background(), clk)
+	in := make(chan int)
+	out := make(chan []interface{})
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- stream.RunWithContext(ctx,
+			strmutil.FromChan(in),
+			strmutil.Batch(strmutil.BatchSize(10), strmutil.BatchLatency(time.Second)),
+			strmutil.ToChan(out),
+		)
+	}()
+
+	in <- 1
+	clk.BlockUntil(1)
+	clk.Advance(time.Second)
+	streamtest.Equal(t, <-out, []interface{}{1})
+
+	in <- 2
+	in <- 3
+	close(in)
+	streamtest.Equal(t, <-out, []interface{}{2, 3})
+
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBatchWaitsConsumer(t *testing.T) {
+	testError := errors.New("test")
+	var returned int32
+	p := stubProc{
+		ctx: context.Background(),
+		consume: func(fn stream.ConsumerFunc) error {
+			defer atomic.StoreInt32(&returned, 1)
+			if err := fn(1); err != nil {
+				return err
+			}
+			// blocks until Batch stops the consumer
+			return fn(2)
+		},
+		send: func(interface{}) error { return testError },
+	}
+	if err := strmutil.Batch(strmutil.BatchSize(1))(p); !errors.Is(err, testError) {
+		t.Fatalf("\nwant: %v\n got: %v\n", testError, err)
+	}
+	if atomic.LoadInt32(&returned) == 0 {
+		t.Error("Batch returned before its consumer")
+	}
+}
+
+// stubProc is a Proc calling consume and send.
+type stubProc struct {
+	ctx     context.Context
+	consume func(fn stream.ConsumerFunc) error
+	send    func(v interface{}) error
+}
+
+func (p stubProc) Context() context.Context             { return p.ctx }
+func (p stubProc) Consume(fn stream.ConsumerFunc) error { return p.consume(fn) }
+func (p stubProc) Send(v interface{}) error             { return p.send(v) }
@@ -0,0 +1,140 @@
+package strmutil
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// FromSlice sends each element of the slice s.
+func FromSlice(s interface{}) ProcFunc {
+	val := reflect.ValueOf(s)
+	if val.Kind() != reflect.Slice && val.Kind() != reflect.Array {
+		panic(fmt.Sprintf("not a slice: %T", s))
+	}
+	return func(p Proc) error {
+		for i := 0; i < val.Len(); i++ {
+			if err := p.Send(val.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// FromChan receives from the go channel ch and sends each value until ch is
+// closed or the context is cancelled.
+func FromChan(ch interface{}) ProcFunc {
+	val := reflect.ValueOf(ch)
+	if val.Kind() != reflect.Chan || val.Type().ChanDir()&reflect.RecvDir == 0 {
+		panic(fmt.Sprintf("not a receive channel: %T", ch))
+	}
+	return func(p Proc) error {
+		cases := []reflect.SelectCase{
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(p.Context().Done())},
+			{Dir: reflect.SelectRecv, Chan: val},
+		}
+		for {
+			chosen, v, ok := reflect.Select(cases)
+			if chosen == 0 {
+				return p.Context().Err()
+			}
+			if !ok {
+				return nil
+			}
+			if err := p.Send(v.Interface()); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Generate calls fn repeatedly and sends the returned value, it stops when fn
+// returns io.EOF or any other error which will be returned.
+func Generate(fn func(ctx context.Context) (interface{}, error)) ProcFunc {
+	return func(p Proc) error {
+		ctx := p.Context()
+		for {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			v, err := fn(ctx)
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := p.Send(v); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// ToSlice appends every consumed value into the slice pointed by ptr, values
+// must be assignable to the slice element type.
+//		var out []int
+//		stream.Run(strmutil.Seq(0, 10, 1), strmutil.ToSlice(&out))
+func ToSlice(ptr interface{}) ProcFunc {
+	val := reflect.ValueOf(ptr)
+	if val.Kind() != reflect.Ptr || val.Elem().Kind() != reflect.Slice {
+		panic(fmt.Sprintf("not a pointer to slice: %T", ptr))
+	}
+	sl := val.Elem()
+	typ := sl.Type().Elem()
+	return func(p Proc) error {
+		return p.Consume(func(v interface{}) error {
+			vv, err := assignableValue(v, typ)
+			if err != nil {
+				return err
+			}
+			sl.Set(reflect.Append(sl, vv))
+			return nil
+		})
+	}
+}
+
+// ToChan forwards every consumed value into the go channel ch, the channel is
+// not closed when the stream ends.
+func ToChan(ch interface{}) ProcFunc {
+	val := reflect.ValueOf(ch)
+	if val.Kind() != reflect.Chan || val.Type().ChanDir()&reflect.SendDir == 0 {
+		panic(fmt.Sprintf("not a send channel: %T", ch))
+	}
+	typ := val.Type().Elem()
+	return func(p Proc) error {
+		done := reflect.ValueOf(p.Context().Done())
+		return p.Consume(func(v interface{}) error {
+			vv, err := assignableValue(v, typ)
+			if err != nil {
+				return err
+			}
+			chosen, _, _ := reflect.Select([]reflect.SelectCase{
+				{Dir: reflect.SelectRecv, Chan: done},
+				{Dir: reflect.SelectSend, Chan: val, Send: vv},
+			})
+			if chosen == 0 {
+				return p.Context().Err()
+			}
+			return nil
+		})
+	}
+}
+
+// assignableValue returns v as a reflect.Value that can be assigned to typ.
+func assignableValue(v interface{}, typ reflect.Type) (reflect.Value, error) {
+	if v == nil {
+		switch typ.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func:
+			return reflect.Zero(typ), nil
+		}
+		return reflect.Value{}, fmt.Errorf("invalid type: nil is not assignable to %v", typ)
+	}
+	vv := reflect.ValueOf(v)
+	if !vv.Type().AssignableTo(typ) {
+		return reflect.Value{}, fmt.Errorf("invalid type: %T is not assignable to %v", v, typ)
+	}
+	return vv, nil
+}
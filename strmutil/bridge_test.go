@@ -0,0 +1,273 @@
+package strmutil_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stdiopt/stream"
+	"github.com/stdiopt/stream/streamtest"
+	"github.com/stdiopt/stream/strmutil"
+)
+
+func TestFromSlice(t *testing.T) {
+	tests := []struct {
+		name      string
+		s         interface{}
+		want      []interface{}
+		wantPanic bool
+	}{
+		{name: "slice", s: []int{1, 2}, want: []interface{}{1, 2}},
+		{name: "array", s: [2]string{"a", "b"}, want: []interface{}{"a", "b"}},
+		{name: "empty", s: []int{}, want: []interface{}{}},
+		{name: "not a slice", s: 1, wantPanic: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantPanic {
+				assertPanic(t, func() { strmutil.FromSlice(tt.s) })
+				return
+			}
+			got, err := streamtest.Run(context.Background(), strmutil.FromSlice(tt.s))
+			if err != nil {
+				t.Fatal(err)
+			}
+			streamtest.Equal(t, got, tt.want)
+		})
+	}
+}
+
+func TestFromChan(t *testing.T) {
+	tests := []struct {
+		name      string
+		ch        func() interface{}
+		cancel    bool
+		want      []interface{}
+		wantErr   error
+		wantPanic bool
+	}{
+		{
+			name: "until closed",
+			ch: func() interface{} {
+				ch := make(chan int, 2)
+				ch <- 1
+				ch <- 2
+				close(ch)
+				return ch
+			},
+			want: []interface{}{1, 2},
+		},
+		{
+			name:    "cancelled while receiving",
+			ch:      func() interface{} { return make(chan int) },
+			cancel:  true,
+			want:    []interface{}{},
+			wantErr: context.Canceled,
+		},
+		{
+			name:      "send only channel",
+			ch:        func() interface{} { return make(chan<- int) },
+			wantPanic: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantPanic {
+				assertPanic(t, func() { strmutil.FromChan(tt.ch()) })
+				return
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				time.AfterFunc(10*time.Millisecond, cancel)
+			}
+			got, err := streamtest.Run(ctx, strmutil.FromChan(tt.ch()))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("\nwant: %v\n got: %v\n", tt.wantErr, err)
+			}
+			streamtest.Equal(t, got, tt.want)
+		})
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	testError := errors.New("test")
+	tests := []struct {
+		name    string
+		fn      func(n int) (interface{}, error)
+		cancel  bool
+		want    []interface{}
+		wantErr error
+	}{
+		{
+			name: "until EOF",
+			fn: func(n int) (interface{}, error) {
+				if n == 3 {
+					return nil, io.EOF
+				}
+				return n, nil
+			},
+			want: []interface{}{0, 1, 2},
+		},
+		{
+			name: "returns error",
+			fn: func(n int) (interface{}, error) {
+				if n == 1 {
+					return nil, testError
+				}
+				return n, nil
+			},
+			want:    []interface{}{0},
+			wantErr: testError,
+		},
+		{
+			name:    "cancelled",
+			fn:      func(n int) (interface{}, error) { return n, nil },
+			cancel:  true,
+			want:    []interface{}{},
+			wantErr: context.Canceled,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				cancel()
+			}
+			n := 0
+			got, err := streamtest.Run(ctx, strmutil.Generate(func(context.Context) (interface{}, error) {
+				v, err := tt.fn(n)
+				n++
+				return v, err
+			}))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("\nwant: %v\n got: %v\n", tt.wantErr, err)
+			}
+			streamtest.Equal(t, got, tt.want)
+		})
+	}
+}
+
+func TestToSlice(t *testing.T) {
+	var (
+		ints []int
+		ptrs []*int
+	)
+	tests := []struct {
+		name      string
+		ptr       interface{}
+		input     []interface{}
+		want      interface{}
+		wantErr   string
+		wantPanic bool
+	}{
+		{name: "appends", ptr: &ints, input: []interface{}{1, 2}, want: []int{1, 2}},
+		{name: "nil element", ptr: &ptrs, input: []interface{}{nil}, want: []*int{nil}},
+		{
+			name:    "wrong element type",
+			ptr:     &ints,
+			input:   []interface{}{"a"},
+			wantErr: "invalid type: string is not assignable to int",
+		},
+		{
+			name:    "nil not assignable",
+			ptr:     &ints,
+			input:   []interface{}{nil},
+			wantErr: "invalid type: nil is not assignable to int",
+		},
+		{name: "not a pointer", ptr: ints, wantPanic: true},
+		{name: "not a slice", ptr: new(int), wantPanic: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ints, ptrs = nil, nil
+			if tt.wantPanic {
+				assertPanic(t, func() { strmutil.ToSlice(tt.ptr) })
+				return
+			}
+			err := stream.Run(strmutil.FromSlice(tt.input), strmutil.ToSlice(tt.ptr))
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("\nwant: %v\n got: %v\n", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := reflect.ValueOf(tt.ptr).Elem().Interface(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("\nwant: %v\n got: %v\n", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestToChan(t *testing.T) {
+	tests := []struct {
+		name      string
+		ch        interface{}
+		input     []interface{}
+		cancel    bool
+		wantErr   string
+		wantPanic bool
+	}{
+		{name: "forwards", ch: make(chan int, 2), input: []interface{}{1, 2}},
+		{
+			name:    "wrong element type",
+			ch:      make(chan int, 1),
+			input:   []interface{}{"a"},
+			wantErr: "invalid type: string is not assignable to int",
+		},
+		{
+			name:    "cancelled while blocked on the channel",
+			ch:      make(chan int),
+			input:   []interface{}{1},
+			cancel:  true,
+			wantErr: context.Canceled.Error(),
+		},
+		{name: "receive only channel", ch: make(<-chan int), wantPanic: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantPanic {
+				assertPanic(t, func() { strmutil.ToChan(tt.ch) })
+				return
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				time.AfterFunc(10*time.Millisecond, cancel)
+			}
+			err := stream.RunWithContext(ctx, strmutil.FromSlice(tt.input), strmutil.ToChan(tt.ch))
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("\nwant: %v\n got: %v\n", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			ch := reflect.ValueOf(tt.ch)
+			for _, want := range tt.input {
+				if got, _ := ch.Recv(); got.Interface() != want {
+					t.Errorf("\nwant: %v\n got: %v\n", want, got)
+				}
+			}
+		})
+	}
+}
+
+func assertPanic(t *testing.T, fn func()) {
+	t.Helper()
+	defer func() {
+		if recover() == nil {
+			t.Error("want panic")
+		}
+	}()
+	fn()
+}
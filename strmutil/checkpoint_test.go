@@ -0,0 +1,126 @@
+package strmutil_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stdiopt/stream"
+	"github.com/stdiopt/stream/strmutil"
+)
+
+func TestSeqCheckpoint(t *testing.T) {
+	testError := errors.New("test")
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+
+	run := func(failOn int) ([]interface{}, error) {
+		ck, err := stream.OpenCheckpoint(path, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := []interface{}{}
+		err = stream.Run(stream.Checkpointed(ck,
+			strmutil.Seq(0, 10, 1),
+			func(p stream.Proc) error {
+				return p.Consume(func(v interface{}) error {
+					if stream.Unwrap(v) == failOn {
+						return testError
+					}
+					return p.Send(stream.Unwrap(v))
+				})
+			},
+			strmutil.ToSlice(&out),
+		))
+		return out, err
+	}
+
+	out, err := run(5)
+	if err != testError {
+		t.Fatalf("\nwant: %v\n got: %v\n", testError, err)
+	}
+	if len(out) > 5 {
+		t.Fatalf("consumed after failure: %v", out)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err = run(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// messages in flight during the failure might be processed again
+	if len(out) < 5 || len(out) == 10 {
+		t.Fatalf("\nwant: resume at or before 5\n got: %v\n", out)
+	}
+	for i, v := range out {
+		if want := 10 - len(out) + i; v != want {
+			t.Errorf("\nwant: %v\n got: %v\n", want, v)
+		}
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("checkpoint should be removed after success: %v", err)
+	}
+}
+
+func TestJSONParseCheckpoint(t *testing.T) {
+	testError := errors.New("test")
+	dir := t.TempDir()
+	path := filepath.Join(dir, "checkpoint.json")
+	data := filepath.Join(dir, "data.json")
+	sb := &strings.Builder{}
+	for i := 0; i < 50; i++ {
+		fmt.Fprintf(sb, "{\"id\":%d}\n", i)
+	}
+	if err := os.WriteFile(data, []byte(sb.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(failOn float64) ([]interface{}, error) {
+		ck, err := stream.OpenCheckpoint(path, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := []interface{}{}
+		err = stream.Run(stream.Checkpointed(ck,
+			// records span several chunks
+			strmutil.FileReader(data, strmutil.ChunkSize(7)),
+			strmutil.JSONParse(nil),
+			func(p stream.Proc) error {
+				return p.Consume(func(v interface{}) error {
+					m, ok := stream.Unwrap(v).(map[string]interface{})
+					if !ok {
+						return fmt.Errorf("not a record: %v", stream.Unwrap(v))
+					}
+					id := m["id"].(float64)
+					if id == failOn {
+						return testError
+					}
+					return p.Send(int(id))
+				})
+			},
+			strmutil.ToSlice(&out),
+		))
+		return out, err
+	}
+
+	if _, err := run(20); err != testError {
+		t.Fatalf("\nwant: %v\n got: %v\n", testError, err)
+	}
+	out, err := run(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// records in flight during the failure might be processed again
+	if len(out) < 30 || len(out) == 50 {
+		t.Fatalf("\nwant: resume at or before 20\n got: %v\n", out)
+	}
+	for i, v := range out {
+		if want := 50 - len(out) + i; v != want {
+			t.Errorf("\nwant: %v\n got: %v\n", want, v)
+		}
+	}
+}
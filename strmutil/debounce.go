@@ -0,0 +1,231 @@
+package strmutil
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/stdiopt/stream"
+)
+
+// Debounce sends the last consumed value of each key once no other value with
+// the same key is consumed for the duration d, if key is nil every value will
+// share the same key, pending values are sent when the stream ends.
+// Keys must be comparable, a key that isn't fails with an error.
+func Debounce(d time.Duration, key func(v interface{}) interface{}) ProcFunc {
+	return debounce(d, func(v interface{}) (interface{}, error) {
+		if key == nil {
+			return nil, nil
+		}
+		return key(v), nil
+	})
+}
+
+// DebounceField is like Debounce but uses the field f of the value as the key,
+// the field is fetched as in FieldOf.
+func DebounceField(d time.Duration, f string) ProcFunc {
+	return debounce(d, func(v interface{}) (interface{}, error) {
+		return FieldOf(v, f)
+	})
+}
+
+func debounce(d time.Duration, keyFn func(v interface{}) (interface{}, error)) ProcFunc {
+	return func(p Proc) (err error) {
+		ctx, cancel := context.WithCancel(p.Context())
+		defer cancel()
+		clk := stream.ClockFrom(ctx)
+
+		in, wait := consumeChan(ctx, p)
+		defer wait() // nolint: errcheck
+
+		pending := map[interface{}]*debounceEntry{}
+		var (
+			order debounceHeap // entries in deadline order
+			seq   int
+		)
+		defer func() {
+			for _, e := range pending {
+				stream.Release(e.value, err)
+			}
+		}()
+		var (
+			timer  stream.Timer
+			timerC <-chan time.Time
+		)
+		schedule := func() {
+			if timer != nil {
+				timer.Stop()
+				timer, timerC = nil, nil
+			}
+			if len(order) == 0 {
+				return
+			}
+			timer = clk.NewTimer(order[0].deadline.Sub(clk.Now()))
+			timerC = timer.C()
+		}
+		// send sends the entries up to now, if now is zero every entry is
+		// sent.
+		send := func(now time.Time) error {
+			for len(order) > 0 {
+				e := order[0]
+				if !now.IsZero() && e.deadline.After(now) {
+					return nil
+				}
+				heap.Pop(&order)
+				delete(pending, e.key)
+				err := p.Send(e.value)
+				stream.Release(e.value, err)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		for {
+			select {
+			case <-timerC:
+				if err := send(clk.Now()); err != nil {
+					return err
+				}
+				timer, timerC = nil, nil
+				schedule()
+			case v, ok := <-in:
+				if !ok {
+					if timer != nil {
+						timer.Stop()
+					}
+					if err := wait(); err != nil {
+						return err
+					}
+					return send(time.Time{})
+				}
+				k, err := keyFn(v)
+				if err == nil && k != nil && !reflect.TypeOf(k).Comparable() {
+					err = fmt.Errorf("invalid key: %T is not comparable", k)
+				}
+				if err != nil {
+					stream.Release(v, err)
+					return err
+				}
+				seq++
+				deadline := clk.Now().Add(d)
+				if e, ok := pending[k]; ok {
+					stream.Release(e.value, nil)
+					e.value, e.deadline, e.seq = v, deadline, seq
+					heap.Fix(&order, e.index)
+				} else {
+					e := &debounceEntry{key: k, value: v, deadline: deadline, seq: seq}
+					pending[k] = e
+					heap.Push(&order, e)
+				}
+				if order[0].seq == seq {
+					schedule()
+				}
+			}
+		}
+	}
+}
+
+type debounceEntry struct {
+	key      interface{}
+	value    interface{}
+	deadline time.Time
+	seq      int // breaks deadline ties in consume order
+	index    int
+}
+
+// debounceHeap implements heap.Interface ordering entries by deadline.
+type debounceHeap []*debounceEntry
+
+func (h debounceHeap) Len() int { return len(h) }
+func (h debounceHeap) Less(i, j int) bool {
+	if h[i].deadline.Equal(h[j].deadline) {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].deadline.Before(h[j].deadline)
+}
+
+func (h debounceHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *debounceHeap) Push(x interface{}) {
+	e := x.(*debounceEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *debounceHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return e
+}
+
+// Throttle sends the first consumed value and drops any other values consumed
+// during the following duration d.
+func Throttle(d time.Duration) ProcFunc {
+	return func(p Proc) error {
+		clk := stream.ClockFrom(p.Context())
+		var last time.Time
+		sent := false
+		return p.Consume(func(v interface{}) error {
+			now := clk.Now()
+			if sent && now.Sub(last) < d {
+				return nil
+			}
+			sent, last = true, now
+			return p.Send(v)
+		})
+	}
+}
+
+// Sample sends the last consumed value every period d, nothing is sent if no
+// value was consumed during the period and the values consumed after the last
+// period are dropped when the stream ends.
+func Sample(d time.Duration) ProcFunc {
+	return func(p Proc) error {
+		ctx, cancel := context.WithCancel(p.Context())
+		defer cancel()
+		ticker := stream.ClockFrom(ctx).NewTicker(d)
+		defer ticker.Stop()
+
+		in, wait := consumeChan(ctx, p)
+		defer wait() // nolint: errcheck
+
+		var last interface{}
+		has := false
+		for {
+			select {
+			case <-ticker.C():
+				if !has {
+					continue
+				}
+				v := last
+				last, has = nil, false
+				err := p.Send(v)
+				stream.Release(v, err)
+				if err != nil {
+					return err
+				}
+			case v, ok := <-in:
+				if !ok {
+					err := wait()
+					if has {
+						stream.Release(last, err)
+					}
+					return err
+				}
+				if has {
+					stream.Release(last, nil)
+				}
+				last, has = v, true
+			}
+		}
+	}
+}
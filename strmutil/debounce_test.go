@@ -0,0 +1,145 @@
+package strmutil_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stdiopt/stream"
+	"github.com/stdiopt/stream/streamtest"
+	"github.com/stdiopt/stream/strmutil"
+)
+
+func TestDebounceField(t *testing.T) {
+	defer streamtest.LeakCheck(t)()
+
+	type event struct {
+		ID    string
+		Value int
+	}
+	clk := streamtest.NewClock(time.Time{})
+	ctx := stream.WithClock(context.Background(), clk)
+	in := make(chan event)
+	out := make(chan event)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- stream.RunWithContext(ctx,
+			strmutil.FromChan(in),
+			strmutil.DebounceField(time.Second, "ID"),
+			strmutil.ToChan(out),
+		)
+	}()
+
+	in <- event{"a", 1}
+	in <- event{"b", 1}
+	in <- event{"a", 2}
+	// extra events to ensure the ones above were processed since there are
+	// two hops between FromChan and the Debounce loop.
+	in <- event{"x", 1}
+	in <- event{"y", 1}
+	in <- event{"z", 1}
+	clk.BlockUntil(1)
+	clk.Advance(time.Second)
+
+	want := []event{{"b", 1}, {"a", 2}}
+	for _, w := range want {
+		if got := <-out; got != w {
+			t.Errorf("\nwant: %v\n got: %v\n", w, got)
+		}
+	}
+	close(in)
+	want = []event{{"x", 1}, {"y", 1}, {"z", 1}}
+	for _, w := range want {
+		if got := <-out; got != w {
+			t.Errorf("\nwant: %v\n got: %v\n", w, got)
+		}
+	}
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDebounceNotComparable(t *testing.T) {
+	_, err := streamtest.Run(context.Background(),
+		strmutil.Debounce(time.Second, func(v interface{}) interface{} { return []int{1} }),
+		1,
+	)
+	if want := "invalid key: []int is not comparable"; err == nil || err.Error() != want {
+		t.Errorf("\nwant: %v\n got: %v\n", want, err)
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	clk := streamtest.NewClock(time.Time{})
+	var got []interface{}
+	p := stubProc{
+		ctx: stream.WithClock(context.Background(), clk),
+		consume: func(fn stream.ConsumerFunc) error {
+			steps := []time.Duration{0, 0, time.Second, time.Second / 2, time.Second / 2}
+			for i, d := range steps {
+				clk.Advance(d)
+				if err := fn(i + 1); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		send: func(v interface{}) error {
+			got = append(got, v)
+			return nil
+		},
+	}
+	if err := strmutil.Throttle(time.Second)(p); err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{1, 3, 5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("\nwant: %v\n got: %v\n", want, got)
+	}
+}
+
+func TestSample(t *testing.T) {
+	defer streamtest.LeakCheck(t)()
+
+	clk := streamtest.NewClock(time.Time{})
+	out := make(chan interface{}, 10)
+	var got []interface{}
+	p := stubProc{
+		ctx: stream.WithClock(context.Background(), clk),
+		consume: func(fn stream.ConsumerFunc) error {
+			// Sample receives each value before fn returns so the ticks
+			// below are handled after the values.
+			for _, v := range []interface{}{1, 2} {
+				if err := fn(v); err != nil {
+					return err
+				}
+			}
+			clk.Advance(time.Second)
+			got = append(got, <-out)
+			// empty period
+			clk.Advance(time.Second)
+			if err := fn(3); err != nil {
+				return err
+			}
+			clk.Advance(time.Second)
+			got = append(got, <-out)
+			// dropped at the end of the stream
+			return fn(4)
+		},
+		send: func(v interface{}) error {
+			out <- v
+			return nil
+		},
+	}
+	if err := strmutil.Sample(time.Second)(p); err != nil {
+		t.Fatal(err)
+	}
+	close(out)
+	for v := range out {
+		got = append(got, v)
+	}
+	if want := []interface{}{2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("\nwant: %v\n got: %v\n", want, got)
+	}
+}
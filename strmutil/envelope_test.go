@@ -0,0 +1,58 @@
+package strmutil_test
+
+import (
+	"testing"
+
+	"github.com/stdiopt/stream"
+	"github.com/stdiopt/stream/streamtest"
+	"github.com/stdiopt/stream/strmutil"
+)
+
+func TestEnvelope(t *testing.T) {
+	meta := stream.Meta{"id": 1}
+	meta2 := stream.Meta{"id": 2}
+	streamtest.Table(t,
+		streamtest.Case{
+			Name: "field",
+			Proc: strmutil.Field("a"),
+			Input: []interface{}{
+				stream.Wrap(map[string]interface{}{"a": "x"}, meta),
+				map[string]interface{}{"a": "y"},
+			},
+			Want: []interface{}{stream.Wrap("x", meta), "y"},
+		},
+		streamtest.Case{
+			Name:  "template",
+			Proc:  strmutil.Template("{{.}}!"),
+			Input: []interface{}{stream.Wrap("x", meta)},
+			Want:  []interface{}{stream.Wrap([]byte("x!"), meta)},
+		},
+		streamtest.Case{
+			Name: "json parse",
+			Proc: strmutil.JSONParse(nil),
+			Input: []interface{}{
+				stream.Wrap([]byte(`"a" "b`), meta),
+				stream.Wrap([]byte(`" "c"`), meta2),
+			},
+			Want: []interface{}{
+				stream.Wrap("a", meta),
+				stream.Wrap("b", meta2),
+				stream.Wrap("c", meta2),
+			},
+		},
+		streamtest.Case{
+			// the decoder reads ahead to find the end of 2
+			Name: "json parse read ahead",
+			Proc: strmutil.JSONParse(nil),
+			Input: []interface{}{
+				stream.Wrap([]byte(`1 2`), meta),
+				stream.Wrap([]byte(` 3`), meta2),
+			},
+			Want: []interface{}{
+				stream.Wrap(1.0, meta),
+				stream.Wrap(2.0, meta),
+				stream.Wrap(3.0, meta2),
+			},
+		},
+	)
+}
@@ -5,19 +5,26 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/stdiopt/stream"
 )
 
 // Field extracts A field from a struct and sends it forward
 // on a map it will walk through map
 // on a slice it's possible to have Field1.0.Field2
+// if the input is a stream.Envelope the field is extracted from the
+// underlying value and sent with the same metadata
 func Field(f string) ProcFunc {
+	fp := CompileField(f)
 	return func(p Proc) error {
 		return p.Consume(func(v interface{}) error {
-			val, err := FieldOf(v, f)
+			val, err := fp.Get(stream.Unwrap(v))
 			if err != nil {
 				return err
 			}
-			return p.Send(val)
+			return p.Send(stream.Rewrap(v, val))
 		})
 	}
 }
@@ -28,8 +35,13 @@ type (
 
 func FieldMap(target interface{}, fm FMap) ProcFunc {
 	typ := reflect.Indirect(reflect.ValueOf(target)).Type()
+	paths := make(map[string]*FieldPath, len(fm))
+	for _, f := range fm {
+		paths[f] = CompileField(f)
+	}
 	return func(p Proc) error {
-		return p.Consume(func(v interface{}) error {
+		return p.Consume(func(env interface{}) error {
+			v := stream.Unwrap(env)
 			sv := reflect.New(typ)
 			vv := sv.Elem()
 			for k, f := range fm {
@@ -51,13 +63,13 @@ func FieldMap(target interface{}, fm FMap) ProcFunc {
 				field.Set(reflect.ValueOf(buf.String()))
 				*/
 
-				val, err := FieldOf(v, f)
+				val, err := paths[f].Get(v)
 				if err != nil {
 					return err
 				}
 				field.Set(reflect.ValueOf(fmt.Sprint(val)))
 			}
-			return p.Send(vv.Interface())
+			return p.Send(stream.Rewrap(env, vv.Interface()))
 		})
 	}
 }
@@ -66,40 +78,141 @@ func FieldMap(target interface{}, fm FMap) ProcFunc {
 // - on a struct it will walk through the struct Fields
 // - on a map[string]interface{} it will walk through map
 // - on a slice it's possible to have Field1.0.Field2
+//
+// The path is compiled and cached as in CompileField.
 func FieldOf(v interface{}, p string) (interface{}, error) {
+	return cachedField(p).Get(v)
+}
+
+// maxCachedFields limits the paths cached by FieldOf.
+const maxCachedFields = 4096
+
+var (
+	fieldCache     sync.Map // map[string]*FieldPath
+	fieldCacheSize int64
+)
+
+func cachedField(p string) *FieldPath {
+	if fp, ok := fieldCache.Load(p); ok {
+		return fp.(*FieldPath)
+	}
+	fp := CompileField(p)
+	if atomic.LoadInt64(&fieldCacheSize) >= maxCachedFields {
+		return fp
+	}
+	if v, loaded := fieldCache.LoadOrStore(p, fp); loaded {
+		return v.(*FieldPath)
+	}
+	atomic.AddInt64(&fieldCacheSize, 1)
+	return fp
+}
+
+// FieldPath is a compiled field path, see CompileField.
+type FieldPath struct {
+	self  bool
+	steps []fieldStep
+}
+
+type fieldStep struct {
+	key    string
+	keyVal reflect.Value // key as a map index
+	index  int
+	idxErr bool
+	fields sync.Map // map[reflect.Type][]int, nil if the struct has no field key
+}
+
+// CompileField compiles the path p to get fields as FieldOf, the struct field
+// indices are cached per type so repeated lookups on the same types don't
+// search the fields again.
+//		ts := strmutil.CompileField("user.created_at")
+//		...
+//		v, err := ts.Get(msg)
+func CompileField(p string) *FieldPath {
 	if p == "." {
-		return v, nil
+		return &FieldPath{self: true}
 	}
 	pp := strings.Split(p, ".")
-	cur := reflect.Indirect(reflect.ValueOf(v))
-	for _, k := range pp {
-		switch cur.Kind() {
+	fp := &FieldPath{steps: make([]fieldStep, len(pp))}
+	for i, k := range pp {
+		s := &fp.steps[i]
+		s.key = k
+		s.keyVal = reflect.ValueOf(k)
+		n, err := strconv.ParseUint(k, 10, 64)
+		s.index, s.idxErr = int(n), err != nil
+	}
+	return fp
+}
+
+// Get returns the field of v.
+func (fp *FieldPath) Get(v interface{}) (interface{}, error) {
+	if fp.self {
+		return v, nil
+	}
+	cur := v
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil, fmt.Errorf("invalid type: %T", v)
+		}
+		cur = rv.Elem().Interface()
+	}
+	for i := range fp.steps {
+		s := &fp.steps[i]
+		switch c := cur.(type) {
+		case map[string]interface{}:
+			val, ok := c[s.key]
+			if !ok {
+				return nil, nil
+			}
+			cur = val
+			continue
+		case []interface{}:
+			if s.idxErr {
+				return reflect.Value{}, fmt.Errorf("slice: field invalid: %q of %T", s.key, v)
+			}
+			cur = c[s.index]
+			continue
+		}
+		rv := reflect.ValueOf(cur)
+		switch rv.Kind() {
 		case reflect.Struct:
-			cur = cur.FieldByName(k)
-			if !cur.IsValid() {
-				return reflect.Value{}, fmt.Errorf("struct: field invalid: %q of %T", k, v)
+			idx := s.fieldIndex(rv.Type())
+			if idx == nil {
+				return reflect.Value{}, fmt.Errorf("struct: field invalid: %q of %T", s.key, v)
 			}
+			rv = rv.FieldByIndex(idx)
 		case reflect.Slice:
-			i, err := strconv.ParseUint(k, 10, 64)
-			if err != nil {
-				return reflect.Value{}, fmt.Errorf("slice: field invalid: %q of %T", k, v)
+			if s.idxErr {
+				return reflect.Value{}, fmt.Errorf("slice: field invalid: %q of %T", s.key, v)
 			}
-			cur = cur.Index(int(i))
+			rv = rv.Index(s.index)
 		case reflect.Map:
-			if cur.Type().Key().Kind() != reflect.String {
-				return reflect.Value{}, fmt.Errorf("map: key invalid: %q of %T", k, v)
+			if rv.Type().Key().Kind() != reflect.String {
+				return reflect.Value{}, fmt.Errorf("map: key invalid: %q of %T", s.key, v)
 			}
-			cur = cur.MapIndex(reflect.ValueOf(k))
-			if !cur.IsValid() {
+			rv = rv.MapIndex(s.keyVal)
+			if !rv.IsValid() {
 				return nil, nil
 			}
 		default:
 			return nil, fmt.Errorf("invalid type: %T", v)
 		}
-		cur = reflect.Indirect(cur)
 		// This will solve stuff with underlying interface types
 		// (e.g: interface{} in map[string]interface{})
-		cur = reflect.ValueOf(cur.Interface())
+		cur = reflect.Indirect(rv).Interface()
+	}
+	return cur, nil
+}
+
+// fieldIndex returns the index of the struct field in typ or nil if there is
+// no such field.
+func (s *fieldStep) fieldIndex(typ reflect.Type) []int {
+	if idx, ok := s.fields.Load(typ); ok {
+		return idx.([]int)
+	}
+	var idx []int
+	if f, ok := typ.FieldByName(s.key); ok {
+		idx = f.Index
 	}
-	return cur.Interface(), nil
+	s.fields.Store(typ, idx)
+	return idx
 }
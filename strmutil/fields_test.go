@@ -0,0 +1,148 @@
+package strmutil_test
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stdiopt/stream/strmutil"
+)
+
+type fieldsInner struct {
+	Name string
+	Tags []string
+}
+
+type fieldsEmbed struct {
+	ID int
+}
+
+type fieldsSample struct {
+	fieldsEmbed
+	Inner  fieldsInner
+	Ptr    *fieldsInner
+	Map    map[string]interface{}
+	Str    map[string]string
+	Int    map[int]string
+	List   []interface{}
+	Any    interface{}
+	Nested map[string]*fieldsInner
+}
+
+func TestFieldOf(t *testing.T) {
+	sample := fieldsSample{
+		fieldsEmbed: fieldsEmbed{ID: 7},
+		Inner:       fieldsInner{Name: "inner", Tags: []string{"a", "b"}},
+		Ptr:         &fieldsInner{Name: "ptr"},
+		Map: map[string]interface{}{
+			"a": map[string]interface{}{"b": []interface{}{1, "two"}},
+			"s": fieldsInner{Name: "in map"},
+		},
+		Str:    map[string]string{"k": "v"},
+		Int:    map[int]string{1: "one"},
+		List:   []interface{}{map[string]interface{}{"x": 1}},
+		Any:    &fieldsInner{Name: "any"},
+		Nested: map[string]*fieldsInner{"n": {Name: "nested"}},
+	}
+	values := []interface{}{
+		sample,
+		&sample,
+		sample.Map,
+		[]interface{}{sample},
+		nil,
+		(*fieldsSample)(nil),
+		42,
+	}
+	paths := []string{
+		".", "", "ID", "Inner.Name", "Inner.Tags.1", "Inner.Tags.x", "Ptr.Name",
+		"Map.a.b.0", "Map.a.b.1", "Map.a.c", "Map.s.Name", "Str.k", "Str.z",
+		"Int.1", "List.0.x", "Any.Name", "Nested.n.Name", "Missing",
+		"a.b", "a.b.1", "s.Name", "0.Inner.Name", "x",
+	}
+	for _, v := range values {
+		for _, p := range paths {
+			want, wantErr := fieldOfReflect(v, p)
+			got, err := strmutil.FieldOf(v, p)
+			if fmt.Sprint(err) != fmt.Sprint(wantErr) {
+				t.Errorf("%T %q\nwant err: %v\n got err: %v\n", v, p, wantErr, err)
+				continue
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%T %q\nwant: %#v\n got: %#v\n", v, p, want, got)
+			}
+			// cached accessors
+			if got, _ := strmutil.CompileField(p).Get(v); !reflect.DeepEqual(got, want) {
+				t.Errorf("%T %q compiled\nwant: %#v\n got: %#v\n", v, p, want, got)
+			}
+		}
+	}
+}
+
+// fieldOfReflect walks v as FieldOf did before paths were compiled.
+func fieldOfReflect(v interface{}, p string) (interface{}, error) {
+	if p == "." {
+		return v, nil
+	}
+	pp := strings.Split(p, ".")
+	cur := reflect.Indirect(reflect.ValueOf(v))
+	for _, k := range pp {
+		switch cur.Kind() {
+		case reflect.Struct:
+			cur = cur.FieldByName(k)
+			if !cur.IsValid() {
+				return reflect.Value{}, fmt.Errorf("struct: field invalid: %q of %T", k, v)
+			}
+		case reflect.Slice:
+			i, err := strconv.ParseUint(k, 10, 64)
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("slice: field invalid: %q of %T", k, v)
+			}
+			cur = cur.Index(int(i))
+		case reflect.Map:
+			if cur.Type().Key().Kind() != reflect.String {
+				return reflect.Value{}, fmt.Errorf("map: key invalid: %q of %T", k, v)
+			}
+			cur = cur.MapIndex(reflect.ValueOf(k))
+			if !cur.IsValid() {
+				return nil, nil
+			}
+		default:
+			return nil, fmt.Errorf("invalid type: %T", v)
+		}
+		cur = reflect.Indirect(cur)
+		cur = reflect.ValueOf(cur.Interface())
+	}
+	return cur.Interface(), nil
+}
+
+func BenchmarkFieldOf(b *testing.B) {
+	values := []struct {
+		name string
+		v    interface{}
+		path string
+	}{
+		{"struct", fieldsSample{Inner: fieldsInner{Name: "x"}}, "Inner.Name"},
+		{"map", map[string]interface{}{"a": map[string]interface{}{"b": 1}}, "a.b"},
+	}
+	for _, tt := range values {
+		tt := tt
+		b.Run(tt.name+"/reflect", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := fieldOfReflect(tt.v, tt.path); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(tt.name+"/compiled", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := strmutil.FieldOf(tt.v, tt.path); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -4,11 +4,13 @@ import (
 	"errors"
 	"io/ioutil"
 	"net/http"
+
+	"github.com/stdiopt/stream"
 )
 
 // HTTPGet receives a stream of urls performs a call and sends the content as []byte
 func HTTPGet(hdr http.Header) ProcFunc {
-	return func(p Proc) error {
+	return stream.Typed(stringType, bytesType, func(p Proc) error {
 		return p.Consume(func(v interface{}) error {
 			url, ok := v.(string)
 			if !ok {
@@ -30,5 +32,5 @@ func HTTPGet(hdr http.Header) ProcFunc {
 			}
 			return p.Send(data)
 		})
-	}
+	})
 }
@@ -4,51 +4,104 @@ import (
 	"errors"
 	"io"
 	"os"
+	"sync"
+
+	"github.com/stdiopt/stream"
 )
 
-func FileReader(path string) ProcFunc {
-	return func(p Proc) error {
+// FileReader reads the file at path and sends chunks of []byte as IOReader.
+func FileReader(path string, opts ...BytesOptFunc) ProcFunc {
+	return stream.Typed(nil, bytesType, func(p Proc) error {
 		f, err := os.Open(path)
 		if err != nil {
 			return err
 		}
 		defer f.Close()
 
-		return IOReader(f)(p)
-	}
+		return IOReader(f, opts...)(p)
+	})
 }
 
-func IOReader(r io.Reader) ProcFunc {
-	return func(p Proc) error {
-		buf := make([]byte, 4096)
+// IOReader reads r and sends chunks of []byte, if r is an *os.File and there
+// is a stream.Checkpoint in the context the chunks are tracked by the file
+// name and a rerun resumes from the last acknowledged chunk, tracked chunks are
+// sent as stream.Envelope (see stream.Checkpoint).
+//
+// Each chunk is a new []byte unless the reader is Pooled, in which case the
+// chunks should be returned to the pool by the sink, see BytesPool.
+func IOReader(r io.Reader, opts ...BytesOptFunc) ProcFunc {
+	o := newBytesOptions(opts)
+	return stream.Typed(nil, bytesType, func(p Proc) error {
+		key := ""
+		if f, ok := r.(*os.File); ok {
+			key = "file:" + f.Name()
+		}
+		ck := stream.CheckpointFrom(p.Context())
+		if key == "" {
+			ck = nil
+		}
+		off, ok := ck.Position(key)
+		if ok {
+			if err := skip(r, off); err != nil {
+				return err
+			}
+		}
+
+		var buf []byte
+		if o.pool == nil {
+			buf = make([]byte, o.chunk)
+		}
 		isEOF := false
 		for !isEOF {
+			if o.pool != nil {
+				buf = o.pool.Get(o.chunk)
+			}
 			n, err := r.Read(buf)
 			if err == io.EOF {
 				isEOF = true
 			} else if err != nil {
 				return err
 			}
-			b := append([]byte{}, buf[:n]...)
-			if err := p.Send(b); err != nil {
+			off += int64(n)
+			b := buf[:n]
+			if o.pool == nil {
+				b = append([]byte{}, b...)
+			}
+			if err := p.Send(ck.Track(key, b, off)); err != nil {
 				return err
 			}
 		}
 		return nil
+	})
+}
+
+// skip advances the reader n bytes.
+func skip(r io.Reader, n int64) error {
+	if s, ok := r.(io.Seeker); ok {
+		_, err := s.Seek(n, io.SeekStart)
+		return err
 	}
+	_, err := io.CopyN(io.Discard, r, n)
+	return err
 }
 
-func IOWriter(w io.Writer) ProcFunc {
-	return func(p Proc) error {
+// IOWriter writes the consumed []byte into w, if it's Pooled the []byte are
+// put back in the pool once written.
+func IOWriter(w io.Writer, opts ...BytesOptFunc) ProcFunc {
+	o := newBytesOptions(opts)
+	return stream.Typed(bytesType, nil, func(p Proc) error {
 		return p.Consume(func(v interface{}) error {
-			b, ok := v.([]byte)
+			b, ok := stream.Unwrap(v).([]byte)
 			if !ok {
 				return errors.New("wrong type")
 			}
 			_, err := w.Write(b)
+			if o.pool != nil {
+				o.pool.Put(b)
+			}
 			return err
 		})
-	}
+	})
 }
 
 type ReadErrorCloser interface {
@@ -56,14 +109,50 @@ type ReadErrorCloser interface {
 	CloseWithError(error) error
 }
 
+// AsReader returns a reader that reads the consumed []byte messages, the
+// messages can also be stream.Envelopes wrapping []byte.
 func AsReader(p Proc) ReadErrorCloser {
+	return newProcReader(p, false)
+}
+
+// procReader reads the consumed bytes and keeps track of the messages they
+// came from, if hold is true the messages are retained until value moves past
+// them or release is called.
+type procReader struct {
+	*io.PipeReader
+
+	hold     bool
+	mu       sync.Mutex
+	read     int64
+	written  int64
+	srcs     []procChunk
+	released bool
+}
+
+type procChunk struct {
+	start, end int64
+	src        interface{}
+}
+
+func newProcReader(p Proc, hold bool) *procReader {
 	pr, pw := io.Pipe()
+	r := &procReader{PipeReader: pr, hold: hold}
 	go func() {
 		err := p.Consume(func(v interface{}) error {
-			b, ok := v.([]byte)
+			b, ok := stream.Unwrap(v).([]byte)
 			if !ok {
 				return errors.New("input must be []byte")
 			}
+			r.mu.Lock()
+			start := r.written
+			r.written += int64(len(b))
+			if !r.released {
+				if r.hold {
+					stream.Retain(v)
+				}
+				r.srcs = append(r.srcs, procChunk{start, r.written, v})
+			}
+			r.mu.Unlock()
 			if _, err := pw.Write(b); err != nil {
 				return pw.CloseWithError(err)
 			}
@@ -71,5 +160,81 @@ func AsReader(p Proc) ReadErrorCloser {
 		})
 		pw.CloseWithError(err) // nolint: errcheck
 	}()
-	return pr
+	return r
+}
+
+func (r *procReader) Read(b []byte) (int, error) {
+	n, err := r.PipeReader.Read(b)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.read += int64(n)
+	if !r.hold {
+		r.drop(r.read)
+	}
+	return n, err
+}
+
+// release releases the messages still held by the reader.
+func (r *procReader) release(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.hold {
+		releaseChunks(r.srcs, err)
+	}
+	r.srcs = nil
+	r.released = true
+}
+
+// value returns v tracked by the consumed messages holding the bytes between
+// the offsets start and end, the previous value ended at the offset prev and
+// the metadata is the one of the message holding the last byte of v.
+//
+// The messages are released once a value boundary follows them, until then
+// every value carries the messages since the last boundary so they are
+// acknowledged together and a Checkpoint doesn't commit a position in the
+// middle of a value.
+func (r *procReader) value(v interface{}, prev, start, end int64) interface{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for i, c := range r.srcs {
+		if c.end > start {
+			break
+		}
+		// no value is split at the end of c
+		if c.end >= prev {
+			n = i + 1
+		}
+	}
+	releaseChunks(r.srcs[:n], nil)
+	r.srcs = r.srcs[n:]
+
+	// latest first so the earliest position is acknowledged last
+	var srcs []interface{}
+	for i := len(r.srcs) - 1; i >= 0; i-- {
+		if r.srcs[i].start < end {
+			srcs = append(srcs, r.srcs[i].src)
+		}
+	}
+	if len(srcs) == 0 {
+		return v
+	}
+	return stream.Join(stream.Rewrap(srcs[0], v), srcs[1:]...)
+}
+
+// drop drops the messages ending before the offset off, mu must be held.
+func (r *procReader) drop(off int64) {
+	for len(r.srcs) > 1 && r.srcs[0].end < off {
+		if r.hold {
+			stream.Release(r.srcs[0].src, nil)
+		}
+		r.srcs = r.srcs[1:]
+	}
+}
+
+// releaseChunks releases the messages of cs starting by the latest.
+func releaseChunks(cs []procChunk, err error) {
+	for i := len(cs) - 1; i >= 0; i-- {
+		stream.Release(cs[i].src, err)
+	}
 }
@@ -6,6 +6,8 @@ import (
 	"io"
 	"log"
 	"reflect"
+
+	"github.com/stdiopt/stream"
 )
 
 // JSONParse parses the []byte input as json and send the object
@@ -18,33 +20,46 @@ import (
 // produce different types map[string]interface{}, []interface{}, string, float64
 // as the regular native json.Unmarshal
 // if the input is not bytes it will error and cancel the pipeline
+// if the input is a stream.Envelope the parsed values are sent with the
+// metadata of the input holding the last byte of the value and tracked by
+// every input holding a part of it
 func JSONParse(v interface{}) ProcFunc {
 	if v == nil {
 		var l interface{}
 		v = &l
 	}
 	typ := reflect.Indirect(reflect.ValueOf(v)).Type()
-	return func(p Proc) error {
-		rd := AsReader(p)
+	return stream.Typed(bytesType, nil, func(p Proc) error {
+		rd := newProcReader(p, true)
 		dec := json.NewDecoder(rd)
+		prev := int64(0)
 		for {
+			dec.More() // skips the spaces before the value
+			start := dec.InputOffset()
 			v := reflect.New(typ).Interface()
 			err := dec.Decode(v)
 			if err == io.EOF {
+				rd.release(nil)
 				return nil
 			}
 			if err != nil {
-				return rd.CloseWithError(err)
+				rd.release(err)
+				rd.CloseWithError(err) // nolint: errcheck
+				return err
 			}
 			// deref
 			if vv, ok := v.(*interface{}); ok {
 				v = *vv
 			}
-			if err := p.Send(v); err != nil {
-				return rd.CloseWithError(err)
+			end := dec.InputOffset()
+			if err := p.Send(rd.value(v, prev, start, end)); err != nil {
+				rd.release(err)
+				rd.CloseWithError(err) // nolint: errcheck
+				return err
 			}
+			prev = end
 		}
-	}
+	})
 }
 
 // JSONDump encodes the input as json into the writer
@@ -0,0 +1,90 @@
+package strmutil
+
+import (
+	"sync"
+)
+
+// BytesPool reuses the []byte messages sent by IOReader, FileReader and
+// Template, the zero value is ready to use.
+//
+// A buffer is only reused after it's explicitly returned with Put, usually by
+// the sink that writes it as IOWriter does with the same pool, the stages in
+// between must not keep the []byte or sub slices of it. Buffers that are
+// never returned are garbage collected as usual.
+//		pool := &strmutil.BytesPool{}
+//		stream.Run(
+//			strmutil.FileReader("big.log", strmutil.Pooled(pool), strmutil.ChunkSize(64<<10)),
+//			strmutil.IOWriter(os.Stdout, strmutil.Pooled(pool)),
+//		)
+type BytesPool struct {
+	// Max is the number of free buffers kept, defaults to 64.
+	Max int
+
+	mu   sync.Mutex
+	free [][]byte
+}
+
+// Get returns a buffer of length n.
+func (bp *BytesPool) Get(n int) []byte {
+	bp.mu.Lock()
+	var b []byte
+	if last := len(bp.free) - 1; last >= 0 {
+		b = bp.free[last]
+		bp.free[last] = nil
+		bp.free = bp.free[:last]
+	}
+	bp.mu.Unlock()
+	if cap(b) < n {
+		return make([]byte, n)
+	}
+	return b[:n]
+}
+
+// Put returns b to the pool, b must not be used after.
+func (bp *BytesPool) Put(b []byte) {
+	max := bp.Max
+	if max <= 0 {
+		max = 64
+	}
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	if len(bp.free) < max {
+		bp.free = append(bp.free, b[:0])
+	}
+}
+
+type bytesOptions struct {
+	chunk int
+	pool  *BytesPool
+}
+
+// BytesOptFunc configures the []byte messages of IOReader, FileReader,
+// Template and IOWriter.
+type BytesOptFunc func(o *bytesOptions)
+
+// ChunkSize sets the size of the chunks read by IOReader and FileReader,
+// defaults to 4096.
+func ChunkSize(n int) BytesOptFunc {
+	return func(o *bytesOptions) {
+		o.chunk = n
+	}
+}
+
+// Pooled takes the buffers of the sent messages from pool or with IOWriter
+// puts the consumed messages back in pool once written, see BytesPool.
+func Pooled(pool *BytesPool) BytesOptFunc {
+	return func(o *bytesOptions) {
+		o.pool = pool
+	}
+}
+
+func newBytesOptions(opts []BytesOptFunc) bytesOptions {
+	o := bytesOptions{}
+	for _, fn := range opts {
+		fn(&o)
+	}
+	if o.chunk <= 0 {
+		o.chunk = 4096
+	}
+	return o
+}
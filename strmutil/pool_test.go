@@ -0,0 +1,133 @@
+package strmutil_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stdiopt/stream"
+	"github.com/stdiopt/stream/strmutil"
+)
+
+func TestBytesPool(t *testing.T) {
+	pool := &strmutil.BytesPool{Max: 1}
+	a := pool.Get(10)
+	b := pool.Get(10)
+	pool.Put(a)
+	pool.Put(b) // over Max, dropped
+	tests := []struct {
+		name   string
+		n      int
+		reused bool
+	}{
+		{name: "reuses returned buffer", n: 5, reused: true},
+		{name: "allocates when empty", n: 5, reused: false},
+	}
+	for _, tt := range tests {
+		got := pool.Get(tt.n)
+		if len(got) != tt.n {
+			t.Errorf("%s\nwant len: %d\n got len: %d\n", tt.name, tt.n, len(got))
+		}
+		if reused := &got[0] == &a[0]; reused != tt.reused {
+			t.Errorf("%s\nwant reused: %v\n got reused: %v\n", tt.name, tt.reused, reused)
+		}
+	}
+}
+
+func TestIOReaderPooled(t *testing.T) {
+	data := strings.Repeat("0123456789", 100)
+	tests := []struct {
+		name string
+		opts []strmutil.BytesOptFunc
+	}{
+		{"default", nil},
+		{"chunk size", []strmutil.BytesOptFunc{strmutil.ChunkSize(7)}},
+		{"pooled", []strmutil.BytesOptFunc{
+			strmutil.ChunkSize(16),
+			strmutil.Pooled(&strmutil.BytesPool{}),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			err := stream.Run(
+				strmutil.IOReader(strings.NewReader(data), tt.opts...),
+				strmutil.IOWriter(out, tt.opts...),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != data {
+				t.Errorf("\nwant: %q\n got: %q\n", data, out.String())
+			}
+		})
+	}
+}
+
+func TestTemplatePooled(t *testing.T) {
+	pool := &strmutil.BytesPool{}
+	out := &bytes.Buffer{}
+	err := stream.Run(
+		strmutil.Seq(1, 6, 1),
+		strmutil.Template("{{.}},", strmutil.Pooled(pool)),
+		strmutil.IOWriter(out, strmutil.Pooled(pool)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "1,2,3,4,5,"; out.String() != want {
+		t.Errorf("\nwant: %q\n got: %q\n", want, out.String())
+	}
+}
+
+func BenchmarkIOReader(b *testing.B) {
+	data := bytes.Repeat([]byte("0123456789"), 1<<16)
+	tests := []struct {
+		name string
+		opts []strmutil.BytesOptFunc
+	}{
+		{"alloc", nil},
+		{"pooled", []strmutil.BytesOptFunc{strmutil.Pooled(&strmutil.BytesPool{})}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		b.Run(tt.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				err := stream.Run(
+					strmutil.IOReader(bytes.NewReader(data), tt.opts...),
+					strmutil.IOWriter(io.Discard, tt.opts...),
+				)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkTemplate(b *testing.B) {
+	tests := []struct {
+		name string
+		opts []strmutil.BytesOptFunc
+	}{
+		{"alloc", nil},
+		{"pooled", []strmutil.BytesOptFunc{strmutil.Pooled(&strmutil.BytesPool{})}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		b.Run(tt.name, func(b *testing.B) {
+			b.ReportAllocs()
+			err := stream.Run(
+				strmutil.Seq(1, b.N, 1),
+				strmutil.Template(strings.Repeat("{{.}} ", 64), tt.opts...),
+				strmutil.IOWriter(io.Discard, tt.opts...),
+			)
+			if err != nil {
+				b.Fatal(err)
+			}
+		})
+	}
+}
@@ -1,20 +1,36 @@
 package strmutil
 
+import (
+	"fmt"
+
+	"github.com/stdiopt/stream"
+)
+
+// Seq sends a sequence of ints from start to end by step, if there is a
+// stream.Checkpoint in the context the values are tracked and a rerun resumes
+// from the last acknowledged value, tracked values are sent as
+// stream.Envelope (see stream.Checkpoint).
 func Seq(start, end, step int) ProcFunc {
-	return func(p Proc) error {
+	return stream.Typed(nil, intType, func(p Proc) error {
+		key := fmt.Sprintf("seq:%d:%d:%d", start, end, step)
+		ck := stream.CheckpointFrom(p.Context())
+		from := start
+		if pos, ok := ck.Position(key); ok {
+			from = int(pos)
+		}
 		if start > end {
-			for i := start; i >= end; i += step {
-				if err := p.Send(i); err != nil {
+			for i := from; i >= end; i += step {
+				if err := p.Send(ck.Track(key, i, int64(i+step))); err != nil {
 					return err
 				}
 			}
 			return nil
 		}
-		for i := start; i < end; i += step {
-			if err := p.Send(i); err != nil {
+		for i := from; i < end; i += step {
+			if err := p.Send(ck.Track(key, i, int64(i+step))); err != nil {
 				return err
 			}
 		}
 		return nil
-	}
+	})
 }
@@ -3,19 +3,23 @@ package strmutil
 import (
 	"fmt"
 	"reflect"
+
+	"github.com/stdiopt/stream"
 )
 
+// Unslice sends each element of the consumed slices, if the input is a
+// stream.Envelope each element is sent with the same metadata.
 func Unslice() ProcFunc {
 	return func(p Proc) error {
 		return p.Consume(func(v interface{}) error {
-			val := reflect.Indirect(reflect.ValueOf(v))
+			val := reflect.Indirect(reflect.ValueOf(stream.Unwrap(v)))
 			if val.Type().Kind() != reflect.Slice {
 				return fmt.Errorf("not a slice: %T", v)
 				// return p.Send(v)
 			}
 
 			for i := 0; i < val.Len(); i++ {
-				if err := p.Send(val.Index(i).Interface()); err != nil {
+				if err := p.Send(stream.Rewrap(v, val.Index(i).Interface())); err != nil {
 					return err
 				}
 			}
@@ -1,6 +1,10 @@
 package strmutil
 
-import "github.com/stdiopt/stream"
+import (
+	"reflect"
+
+	"github.com/stdiopt/stream"
+)
 
 // End just a type used in several group streams to send the group
 var End = struct{}{}
@@ -9,3 +13,10 @@ type (
 	ProcFunc = stream.ProcFunc
 	Proc     = stream.Proc
 )
+
+// types declared by stages, see stream.Typed
+var (
+	bytesType  = reflect.TypeOf([]byte(nil))
+	stringType = reflect.TypeOf("")
+	intType    = reflect.TypeOf(0)
+)
@@ -4,10 +4,19 @@ import (
 	"bytes"
 	"fmt"
 	"text/template"
+
+	"github.com/stdiopt/stream"
 )
 
-func Template(s string) ProcFunc {
-	return func(p Proc) error {
+// Template executes the text/template s with each consumed value and sends the
+// result as []byte, the esc func quotes a string.
+//
+// The results are allocated for each message unless the template is Pooled,
+// in which case they should be returned to the pool by the sink, see
+// BytesPool, ChunkSize is ignored.
+func Template(s string, opts ...BytesOptFunc) ProcFunc {
+	o := newBytesOptions(opts)
+	return stream.Typed(nil, bytesType, func(p Proc) error {
 		tmpl := template.New("/")
 		tmpl = tmpl.Option("missingkey=error")
 		tmpl = tmpl.Funcs(template.FuncMap{
@@ -19,12 +28,23 @@ func Template(s string) ProcFunc {
 		if err != nil {
 			return err
 		}
+		// executes into a single buffer and copies the result to a pooled one
+		pooled := &bytes.Buffer{}
 		return p.Consume(func(v interface{}) error {
-			buf := &bytes.Buffer{}
-			if err := tmpl.Execute(buf, v); err != nil {
+			if o.pool == nil {
+				buf := &bytes.Buffer{}
+				if err := tmpl.Execute(buf, stream.Unwrap(v)); err != nil {
+					return err
+				}
+				return p.Send(stream.Rewrap(v, buf.Bytes()))
+			}
+			pooled.Reset()
+			if err := tmpl.Execute(pooled, stream.Unwrap(v)); err != nil {
 				return err
 			}
-			return p.Send(buf.Bytes())
+			b := o.pool.Get(pooled.Len())
+			copy(b, pooled.Bytes())
+			return p.Send(stream.Rewrap(v, b))
 		})
-	}
+	})
 }
@@ -0,0 +1,262 @@
+package stream
+
+import (
+	"container/heap"
+	"context"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// TimerEvent is passed to the OnTimer func when a timer fires.
+type TimerEvent struct {
+	Key  interface{}
+	Time time.Time
+	// EventTime is true if the timer was registered with SetEventTimer.
+	EventTime bool
+}
+
+// TimerProc is the Proc received by the ProcFunc of Timers, timer methods
+// must be called from the ProcFunc go routine, which includes the consume
+// and OnTimer funcs.
+type TimerProc interface {
+	Proc
+	// SetTimer registers a processing time timer for key firing at t,
+	// replacing the previous processing time timer of key.
+	SetTimer(key interface{}, t time.Time)
+	// SetEventTimer registers an event time timer for key firing when the
+	// watermark reaches t, replacing the previous event time timer of key.
+	SetEventTimer(key interface{}, t time.Time)
+	// DeleteTimer removes the processing time timer of key.
+	DeleteTimer(key interface{})
+	// DeleteEventTimer removes the event time timer of key.
+	DeleteEventTimer(key interface{})
+	// OnTimer sets the func called when a timer fires.
+	OnTimer(fn func(e TimerEvent) error)
+	// Watermark returns the highest event time consumed so far.
+	Watermark() time.Time
+}
+
+// Timers returns a ProcFunc that calls fn with a TimerProc, timers fire
+// serially with the consume func so the state shared by both doesn't need
+// locking.
+//
+// eventTime returns the event time of a consumed value and is used to advance
+// the watermark after the value is consumed, it can be nil if only processing
+// time timers are used. Processing time uses the Clock from the context.
+//
+// When the input ends the remaining event time timers are fired and the
+// processing time timers are discarded.
+//		stream.Timers(eventTime, func(p stream.TimerProc) error {
+//			p.OnTimer(func(e stream.TimerEvent) error {
+//				return p.Send(fmt.Sprintf("no heartbeat from %v", e.Key))
+//			})
+//			return p.Consume(func(v interface{}) error {
+//				p.SetEventTimer(key(v), eventTime(v).Add(5*time.Minute))
+//				return nil
+//			})
+//		})
+func Timers(eventTime func(v interface{}) time.Time, fn func(p TimerProc) error) ProcFunc {
+	return func(p Proc) error {
+		tp := &timerProc{
+			Proc:      p,
+			eventTime: eventTime,
+			clock:     ClockFrom(p.Context()),
+			procKeys:  map[interface{}]*timerItem{},
+			eventKeys: map[interface{}]*timerItem{},
+		}
+		return fn(tp)
+	}
+}
+
+type timerProc struct {
+	Proc
+	eventTime func(v interface{}) time.Time
+	clock     Clock
+	onTimer   func(e TimerEvent) error
+	watermark time.Time
+
+	procTimers  timerHeap
+	procKeys    map[interface{}]*timerItem
+	eventTimers timerHeap
+	eventKeys   map[interface{}]*timerItem
+}
+
+func (p *timerProc) SetTimer(key interface{}, t time.Time) {
+	setTimer(&p.procTimers, p.procKeys, key, t)
+}
+
+func (p *timerProc) SetEventTimer(key interface{}, t time.Time) {
+	setTimer(&p.eventTimers, p.eventKeys, key, t)
+}
+
+func (p *timerProc) DeleteTimer(key interface{}) {
+	deleteTimer(&p.procTimers, p.procKeys, key)
+}
+
+func (p *timerProc) DeleteEventTimer(key interface{}) {
+	deleteTimer(&p.eventTimers, p.eventKeys, key)
+}
+
+func (p *timerProc) OnTimer(fn func(e TimerEvent) error) {
+	p.onTimer = fn
+}
+
+func (p *timerProc) Watermark() time.Time {
+	return p.watermark
+}
+
+// Consume consumes the underlying Proc and fires the timers in between the
+// calls to fn.
+func (p *timerProc) Consume(fn ConsumerFunc) error {
+	ctx, cancel := context.WithCancel(p.Context())
+	in := make(chan interface{})
+	var eg errgroup.Group
+	eg.Go(func() error {
+		defer close(in)
+		return p.Proc.Consume(func(v interface{}) error {
+			Retain(v)
+			select {
+			case <-ctx.Done():
+				Release(v, ctx.Err())
+				return ctx.Err()
+			case in <- v:
+				return nil
+			}
+		})
+	})
+	// stops the consumer on early returns
+	defer func() {
+		cancel()
+		eg.Wait() // nolint: errcheck
+	}()
+
+	var (
+		timer  Timer
+		timerC <-chan time.Time
+		next   time.Time
+	)
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	for {
+		// reschedule the clock timer if the earliest processing timer changed
+		if len(p.procTimers) == 0 {
+			if timer != nil {
+				timer.Stop()
+				timer, timerC = nil, nil
+			}
+		} else if at := p.procTimers[0].at; timer == nil || !at.Equal(next) {
+			if timer != nil {
+				timer.Stop()
+			}
+			next = at
+			timer = p.clock.NewTimer(at.Sub(p.clock.Now()))
+			timerC = timer.C()
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timerC:
+			timer, timerC = nil, nil
+			if err := p.fire(&p.procTimers, p.procKeys, p.clock.Now(), false); err != nil {
+				return err
+			}
+		case v, ok := <-in:
+			if !ok {
+				if err := eg.Wait(); err != nil {
+					return err
+				}
+				return p.fire(&p.eventTimers, p.eventKeys, time.Time{}, true)
+			}
+			err := fn(v)
+			Release(v, err)
+			if err != nil {
+				return err
+			}
+			if p.eventTime == nil {
+				continue
+			}
+			if t := p.eventTime(Unwrap(v)); t.After(p.watermark) {
+				p.watermark = t
+			}
+			if err := p.fire(&p.eventTimers, p.eventKeys, p.watermark, true); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// fire calls the OnTimer func for timers up to now, if now is zero every
+// timer is fired.
+func (p *timerProc) fire(h *timerHeap, keys map[interface{}]*timerItem, now time.Time, eventTime bool) error {
+	for len(*h) > 0 {
+		it := (*h)[0]
+		if !now.IsZero() && it.at.After(now) {
+			return nil
+		}
+		heap.Pop(h)
+		delete(keys, it.key)
+		if p.onTimer == nil {
+			continue
+		}
+		if err := p.onTimer(TimerEvent{Key: it.key, Time: it.at, EventTime: eventTime}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setTimer(h *timerHeap, keys map[interface{}]*timerItem, key interface{}, t time.Time) {
+	if it, ok := keys[key]; ok {
+		it.at = t
+		heap.Fix(h, it.index)
+		return
+	}
+	it := &timerItem{key: key, at: t}
+	keys[key] = it
+	heap.Push(h, it)
+}
+
+func deleteTimer(h *timerHeap, keys map[interface{}]*timerItem, key interface{}) {
+	it, ok := keys[key]
+	if !ok {
+		return
+	}
+	heap.Remove(h, it.index)
+	delete(keys, key)
+}
+
+type timerItem struct {
+	key   interface{}
+	at    time.Time
+	index int
+}
+
+// timerHeap implements heap.Interface ordering timers by time.
+type timerHeap []*timerItem
+
+func (h timerHeap) Len() int           { return len(h) }
+func (h timerHeap) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+func (h timerHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *timerHeap) Push(x interface{}) {
+	it := x.(*timerItem)
+	it.index = len(*h)
+	*h = append(*h, it)
+}
+
+func (h *timerHeap) Pop() interface{} {
+	old := *h
+	it := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return it
+}
@@ -0,0 +1,142 @@
+package stream_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stdiopt/stream"
+	"github.com/stdiopt/stream/streamtest"
+	"github.com/stdiopt/stream/strmutil"
+)
+
+type heartbeat struct {
+	ID   string
+	Time time.Time
+}
+
+func TestTimersEventTime(t *testing.T) {
+	t0 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	eventTime := func(v interface{}) time.Time { return v.(heartbeat).Time }
+	alert := stream.Timers(eventTime, func(p stream.TimerProc) error {
+		p.OnTimer(func(e stream.TimerEvent) error {
+			return p.Send(fmt.Sprintf("%v missing at %v", e.Key, e.Time.Sub(t0)))
+		})
+		return p.Consume(func(v interface{}) error {
+			hb := v.(heartbeat)
+			p.SetEventTimer(hb.ID, hb.Time.Add(5*time.Minute))
+			return nil
+		})
+	})
+
+	streamtest.Table(t, streamtest.Case{
+		Name: "alerts missing heartbeats",
+		Proc: alert,
+		Input: []interface{}{
+			heartbeat{"a", t0},
+			heartbeat{"b", t0},
+			heartbeat{"a", t0.Add(3 * time.Minute)},
+			heartbeat{"a", t0.Add(6 * time.Minute)},
+			heartbeat{"b", t0.Add(7 * time.Minute)},
+		},
+		Want: []interface{}{
+			"b missing at 5m0s",
+			"a missing at 11m0s",
+			"b missing at 12m0s",
+		},
+	})
+}
+
+func TestTimersProcessingTime(t *testing.T) {
+	defer streamtest.LeakCheck(t)()
+
+	clk := streamtest.NewClock(time.Time{})
+	ctx := stream.WithClock(context.Background(), clk)
+	in := make(chan string)
+	out := make(chan string)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- stream.RunWithContext(ctx,
+			strmutil.FromChan(in),
+			stream.Timers(nil, func(p stream.TimerProc) error {
+				count := map[interface{}]int{}
+				p.OnTimer(func(e stream.TimerEvent) error {
+					n := count[e.Key]
+					delete(count, e.Key)
+					return p.Send(fmt.Sprintf("%v:%d", e.Key, n))
+				})
+				return p.Consume(func(v interface{}) error {
+					if v == "-" { // sync
+						return nil
+					}
+					if count[v] == 0 {
+						p.SetTimer(v, clk.Now().Add(time.Second))
+					}
+					count[v]++
+					return nil
+				})
+			}),
+			strmutil.ToChan(out),
+		)
+	}()
+
+	in <- "a"
+	clk.BlockUntil(1)
+	in <- "b"
+	in <- "a"
+	// ensure the values above were consumed
+	in <- "-"
+	in <- "-"
+	in <- "-"
+	clk.Advance(time.Second)
+	for _, want := range []string{"a:2", "b:1"} {
+		if got := <-out; got != want {
+			t.Errorf("\nwant: %v\n got: %v\n", want, got)
+		}
+	}
+	close(in)
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTimersWaitsConsumer(t *testing.T) {
+	testError := errors.New("test")
+	var returned int32
+	p := stubProc{
+		ctx: context.Background(),
+		consume: func(fn stream.ConsumerFunc) error {
+			defer atomic.StoreInt32(&returned, 1)
+			if err := fn(1); err != nil {
+				return err
+			}
+			// blocks until Timers stops the consumer
+			return fn(2)
+		},
+		send: func(interface{}) error { return nil },
+	}
+	err := stream.Timers(nil, func(p stream.TimerProc) error {
+		return p.Consume(func(interface{}) error { return testError })
+	})(p)
+	if !errors.Is(err, testError) {
+		t.Fatalf("\nwant: %v\n got: %v\n", testError, err)
+	}
+	if atomic.LoadInt32(&returned) == 0 {
+		t.Error("Timers returned before its consumer")
+	}
+}
+
+// stubProc is a Proc calling consume and send.
+type stubProc struct {
+	ctx     context.Context
+	consume func(fn stream.ConsumerFunc) error
+	send    func(v interface{}) error
+}
+
+func (p stubProc) Context() context.Context             { return p.ctx }
+func (p stubProc) Consume(fn stream.ConsumerFunc) error { return p.consume(fn) }
+func (p stubProc) Send(v interface{}) error             { return p.send(v) }
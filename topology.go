@@ -0,0 +1,257 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Topology describes the structure of a pipeline, see Describe.
+type Topology struct {
+	// Kind is one of line, broadcast, balance, workers, autoworkers,
+	// buffer, checkpoint, graph, ports or func for ProcFuncs that aren't
+	// compositions.
+	Kind string `json:"kind"`
+	// Name is set by Named or by the node name in a Graph.
+	Name string `json:"name,omitempty"`
+	// Func is the name of the func of a func Topology.
+	Func string `json:"func,omitempty"`
+	// MinWorkers and Workers are the number of workers, AutoWorkers runs
+	// between MinWorkers and Workers.
+	MinWorkers int `json:"min_workers,omitempty"`
+	// Strategy is the strategy of a balance Topology.
+	Strategy string `json:"strategy,omitempty"`
+	// Queue is the kind of the buffer of a buffer or broadcast Topology or of
+	// the links of a line Topology when it isn't a Chan, i.e: priority.
+	Queue string `json:"queue,omitempty"`
+	// Port is the output port connected to a child of a ports Topology.
+	Port string `json:"port,omitempty"`
+	// Outputs are the output ports declared with Outputs.
+	Outputs []string `json:"outputs,omitempty"`
+	// In and Out are the types declared with Typed.
+	In       string         `json:"in,omitempty"`
+	Out      string         `json:"out,omitempty"`
+	Workers  int            `json:"workers,omitempty"`
+	Buffer   int            `json:"buffer,omitempty"`
+	Children []*Topology    `json:"children,omitempty"`
+	Edges    []TopologyEdge `json:"edges,omitempty"`
+
+	in, out reflect.Type
+	stats   *stageStats
+	stage   string // unique name of a func in a run
+}
+
+// TopologyEdge is an edge between the named children of a graph Topology.
+type TopologyEdge struct {
+	From string `json:"from"`
+	Port string `json:"port,omitempty"`
+	To   string `json:"to"`
+}
+
+// Describe returns the Topology of pfns as a Line, compositions describe their
+// children without running them.
+func Describe(pfns ...ProcFunc) *Topology {
+	return describe(Line(pfns...), "")
+}
+
+// Named names the Line of pfns in the Topology.
+func Named(name string, pfns ...ProcFunc) ProcFunc {
+	pfn := Line(pfns...)
+	return composite(func(p Proc) error {
+		if t := topologyFrom(p.Context()); t != nil {
+			t.Children = append(t.Children, describe(pfn, name))
+			return nil
+		}
+		return pfn(p)
+	})
+}
+
+// WriteDOT writes the Topology as a Graphviz digraph into w, Workers, Buffer,
+// PriorityMerge, LineWith, Checkpointed, Graph and Named compositions are
+// rendered as clusters and port edges are labeled with the port name.
+func (t *Topology) WriteDOT(w io.Writer) error {
+	d := &dotWriter{}
+	d.WriteString("digraph {\n\trankdir=LR;\n")
+	d.topology(t, "\t")
+	d.WriteString(d.edges.String())
+	d.WriteString("}\n")
+	_, err := d.WriteTo(w)
+	return err
+}
+
+type dotWriter struct {
+	bytes.Buffer
+	edges bytes.Buffer
+	id    int
+}
+
+// topology writes the nodes of t and returns the ids of the nodes where t
+// consumes from and sends to.
+func (d *dotWriter) topology(t *Topology, indent string) (entries, exits []string) {
+	if t.Kind == "func" {
+		d.id++
+		id := "n" + strconv.Itoa(d.id)
+		label := t.Name
+		if label == "" {
+			label = t.Func
+		}
+		fmt.Fprintf(d, "%s%s [label=%s];\n", indent, id, strconv.Quote(label))
+		return []string{id}, []string{id}
+	}
+
+	inner := indent
+	if t.Name != "" || (t.Kind != "line" && t.Kind != "broadcast" && t.Kind != "ports") || t.Queue != "" {
+		d.id++
+		label := t.Kind
+		if t.Name != "" {
+			label = t.Name
+		}
+		switch t.Kind {
+		case "workers":
+			label += fmt.Sprintf(" (%d)", t.Workers)
+		case "autoworkers":
+			label += fmt.Sprintf(" (%d-%d)", t.MinWorkers, t.Workers)
+		case "balance":
+			label += fmt.Sprintf(" (%s)", t.Strategy)
+		case "buffer", "broadcast", "line":
+			if t.Queue != "" {
+				label += fmt.Sprintf(" (%d, %s)", t.Buffer, t.Queue)
+			} else if t.Kind == "buffer" {
+				label += fmt.Sprintf(" (%d)", t.Buffer)
+			}
+		}
+		fmt.Fprintf(d, "%ssubgraph cluster_%d {\n%s\tlabel=%s;\n", indent, d.id, indent, strconv.Quote(label))
+		inner = indent + "\t"
+		defer fmt.Fprintf(d, "%s}\n", indent)
+	}
+
+	ends := make([][2][]string, len(t.Children))
+	for i, c := range t.Children {
+		ends[i][0], ends[i][1] = d.topology(c, inner)
+	}
+	switch t.Kind {
+	case "broadcast", "balance":
+		for _, e := range ends {
+			entries = append(entries, e[0]...)
+			exits = append(exits, e[1]...)
+		}
+	case "graph":
+		index := map[string]int{}
+		hasIn := map[string]bool{}
+		hasOut := map[string]bool{}
+		for i, c := range t.Children {
+			index[c.Name] = i
+		}
+		for _, e := range t.Edges {
+			d.connect(ends[index[e.From]][1], ends[index[e.To]][0], e.Port)
+			if e.Port == "" {
+				hasOut[e.From] = true
+			}
+			hasIn[e.To] = true
+		}
+		for i, c := range t.Children {
+			if !hasIn[c.Name] {
+				entries = append(entries, ends[i][0]...)
+			}
+			if !hasOut[c.Name] {
+				exits = append(exits, ends[i][1]...)
+			}
+		}
+	case "ports":
+		entries, exits = ends[0][0], ends[0][1]
+		for i, c := range t.Children[1:] {
+			d.connect(ends[0][1], ends[i+1][0], c.Port)
+			exits = append(exits, ends[i+1][1]...)
+		}
+	default:
+		for i := 1; i < len(ends); i++ {
+			d.connect(ends[i-1][1], ends[i][0], "")
+		}
+		if len(ends) > 0 {
+			entries, exits = ends[0][0], ends[len(ends)-1][1]
+		}
+	}
+	return entries, exits
+}
+
+func (d *dotWriter) connect(from, to []string, port string) {
+	attrs := ""
+	if port != "" {
+		attrs = " [label=" + strconv.Quote(port) + "]"
+	}
+	for _, f := range from {
+		for _, t := range to {
+			fmt.Fprintf(&d.edges, "\t%s -> %s%s;\n", f, t, attrs)
+		}
+	}
+}
+
+type topologyKey struct{}
+
+func topologyFrom(ctx context.Context) *Topology {
+	if ctx == nil {
+		return nil
+	}
+	t, _ := ctx.Value(topologyKey{}).(*Topology)
+	return t
+}
+
+// add appends c to the children of t and describes pfns as children of c.
+func (t *Topology) add(c *Topology, pfns ...ProcFunc) error {
+	for _, pfn := range pfns {
+		c.Children = append(c.Children, describe(pfn, ""))
+	}
+	t.Children = append(t.Children, c)
+	return nil
+}
+
+// composites holds the code pointers of the funcs returned by compositions,
+// they share the code of every func returned by the same composition so the
+// set doesn't grow with the number of pipelines built.
+var composites sync.Map
+
+// composite registers pfn as a composition that describes itself when called
+// with a Topology in the context.
+func composite(pfn ProcFunc) ProcFunc {
+	composites.Store(reflect.ValueOf(pfn).Pointer(), true)
+	return pfn
+}
+
+func describe(pfn ProcFunc, name string) *Topology {
+	ptr := reflect.ValueOf(pfn).Pointer()
+	if _, ok := composites.Load(ptr); !ok {
+		return &Topology{Kind: "func", Name: name, Func: funcName(ptr)}
+	}
+	parent := &Topology{}
+	ctx := context.WithValue(context.Background(), topologyKey{}, parent)
+	pfn(proc{ctx: ctx}) // nolint: errcheck
+	t := parent.Children[0]
+	if name != "" {
+		t.Name = name
+	}
+	return t
+}
+
+var closureSuffix = regexp.MustCompile(`(\.func\d+)+$`)
+
+// funcName returns the package qualified name of the func at ptr without the
+// closure suffixes, i.e: strmutil.Field
+func funcName(ptr uintptr) string {
+	f := runtime.FuncForPC(ptr)
+	if f == nil {
+		return "func"
+	}
+	name := f.Name()
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	name = closureSuffix.ReplaceAllString(name, "")
+	return strings.TrimSuffix(name, ".glob.")
+}
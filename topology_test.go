@@ -0,0 +1,62 @@
+package stream_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stdiopt/stream"
+	"github.com/stdiopt/stream/streamtest"
+	"github.com/stdiopt/stream/strmutil"
+)
+
+func TestDescribe(t *testing.T) {
+	g, err := stream.NewGraph().
+		Node("a", prefix("a")).
+		Node("b", prefix("b")).
+		Edge("a", "b").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	top := stream.Describe(
+		strmutil.Value("x"),
+		stream.Workers(4, prefix("w"), strmutil.Field("f")),
+		stream.Broadcast(
+			stream.Named("upper", prefix("u")),
+			stream.Buffer(10, g),
+		),
+	)
+	streamtest.Golden(t, "describe.golden", top)
+
+	buf := &bytes.Buffer{}
+	if err := top.WriteDOT(buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `digraph {
+	rankdir=LR;
+	n1 [label="strmutil.Value"];
+	subgraph cluster_2 {
+		label="workers (4)";
+		n3 [label="stream_test.prefix"];
+		n4 [label="strmutil.Field"];
+	}
+	n5 [label="upper"];
+	subgraph cluster_6 {
+		label="buffer (10)";
+		subgraph cluster_7 {
+			label="graph";
+			n8 [label="a"];
+			n9 [label="b"];
+		}
+	}
+	n3 -> n4;
+	n8 -> n9;
+	n1 -> n3;
+	n4 -> n5;
+	n4 -> n8;
+}
+`
+	if got := buf.String(); got != want {
+		t.Errorf("\nwant: %v\n got: %v\n", want, got)
+	}
+}
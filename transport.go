@@ -0,0 +1,233 @@
+package stream
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Transport creates the channels linking the stages of a Line, see LineWith
+// and WithTransport.
+type Transport interface {
+	// link returns the channel between the stages from and to, a nil stage
+	// is a single goroutine
+	link(ctx context.Context, from, to ProcFunc) queue
+	describe(t *Topology)
+}
+
+type transportKey struct{}
+
+// WithTransport returns a context where Lines link their stages with tr,
+// except the ones created by LineWith.
+func WithTransport(ctx context.Context, tr Transport) context.Context {
+	return context.WithValue(ctx, transportKey{}, tr)
+}
+
+// newLink returns the channel linking the stages from and to of a Line
+// running with ctx.
+func newLink(ctx context.Context, from, to ProcFunc) queue {
+	if tr, ok := ctx.Value(transportKey{}).(Transport); ok {
+		return tr.link(ctx, from, to)
+	}
+	return NewChan(ctx, 0)
+}
+
+// LineWith is a Line where the stages are linked by tr, Lines nested in pfns
+// use tr too.
+//		stream.LineWith(stream.BatchTransport(64, time.Millisecond),
+//			strmutil.Seq(1, 1000000, 1),
+//			strmutil.Map(double),
+//			sink,
+//		)
+func LineWith(tr Transport, pfns ...ProcFunc) ProcFunc {
+	if len(pfns) == 0 {
+		panic("no funcs")
+	}
+	return composite(func(p Proc) error {
+		if t := topologyFrom(p.Context()); t != nil {
+			d := &Topology{Kind: "line"}
+			tr.describe(d)
+			return t.add(d, pfns...)
+		}
+		ctx := p.Context()
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		return runLine(proc{WithTransport(ctx, tr), p, p}, pfns)
+	})
+}
+
+// BatchTransport links stages sending up to size messages at once, which
+// saves the cost of handing over each message to the next stage.
+//
+// Messages are handed over when the batch is full or when latency elapsed
+// since the first message of the batch was sent, size defaults to 64 and
+// latency to 1 millisecond.
+func BatchTransport(size int, latency time.Duration) Transport {
+	if size <= 0 {
+		size = 64
+	}
+	if latency <= 0 {
+		latency = time.Millisecond
+	}
+	return batchTransport{size, latency}
+}
+
+type batchTransport struct {
+	size    int
+	latency time.Duration
+}
+
+func (tr batchTransport) link(ctx context.Context, _, _ ProcFunc) queue {
+	c := &batchChan{
+		ctx:     ctx,
+		clock:   ClockFrom(ctx),
+		size:    tr.size,
+		latency: tr.latency,
+		ch:      make(chan []interface{}),
+		pending: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		batch:   make([]interface{}, 0, tr.size),
+	}
+	go c.flusher()
+	return c
+}
+
+func (tr batchTransport) describe(t *Topology) {
+	t.Buffer = tr.size
+	t.Queue = "batch"
+}
+
+// batchChan is a channel sending messages in batches.
+type batchChan struct {
+	ctx     context.Context
+	clock   Clock
+	size    int
+	latency time.Duration
+	ch      chan []interface{}
+	pending chan struct{} // signals the flusher a batch started
+	done    chan struct{}
+
+	sendMu sync.Mutex // held while sending a batch so batches keep their order
+
+	mu      sync.Mutex
+	batch   []interface{}
+	started time.Time
+	gen     int // incremented on every flush
+}
+
+// Send adds v to the current batch and sends the batch once it's full, if
+// context is cancelled it will return the underlying ctx.Err().
+func (c *batchChan) Send(v interface{}) error {
+	Retain(v)
+	if err := c.ctx.Err(); err != nil {
+		Release(v, err)
+		return err
+	}
+	c.mu.Lock()
+	c.batch = append(c.batch, v)
+	if len(c.batch) == 1 {
+		c.started = c.clock.Now()
+		signal(c.pending)
+	}
+	full := len(c.batch) >= c.size
+	c.mu.Unlock()
+	if !full {
+		return nil
+	}
+	return c.flush(-1)
+}
+
+func (c *batchChan) Consume(fn ConsumerFunc) error {
+	for {
+		select {
+		case <-c.ctx.Done():
+			return c.ctx.Err()
+		case b, ok := <-c.ch:
+			if !ok {
+				return nil
+			}
+			for i, v := range b {
+				err := fn(v)
+				Release(v, err)
+				if err == nil {
+					continue
+				}
+				for _, v := range b[i+1:] {
+					Release(v, err)
+				}
+				return err
+			}
+		}
+	}
+}
+
+// Close sends the pending messages and closes the channel.
+func (c *batchChan) Close() {
+	c.flush(-1) // nolint: errcheck
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	close(c.done)
+	close(c.ch)
+}
+
+// flush sends the current batch if it's not empty, if gen isn't negative the
+// batch is only sent if it's still the batch of gen.
+func (c *batchChan) flush(gen int) error {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	c.mu.Lock()
+	if len(c.batch) == 0 || (gen >= 0 && gen != c.gen) {
+		c.mu.Unlock()
+		return nil
+	}
+	b := c.batch
+	c.batch = make([]interface{}, 0, c.size)
+	c.gen++
+	c.mu.Unlock()
+
+	select {
+	case c.ch <- b:
+		return nil
+	case <-c.ctx.Done():
+		for _, v := range b {
+			Release(v, c.ctx.Err())
+		}
+		return c.ctx.Err()
+	}
+}
+
+// flusher sends the batches that aren't full once latency elapsed.
+func (c *batchChan) flusher() {
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-c.done:
+			return
+		case <-c.pending:
+		}
+		for {
+			c.mu.Lock()
+			if len(c.batch) == 0 {
+				c.mu.Unlock()
+				break
+			}
+			gen, wait := c.gen, c.started.Add(c.latency).Sub(c.clock.Now())
+			c.mu.Unlock()
+			if wait > 0 {
+				t := c.clock.NewTimer(wait)
+				select {
+				case <-c.ctx.Done():
+					t.Stop()
+					return
+				case <-c.done:
+					t.Stop()
+					return
+				case <-t.C():
+				}
+			}
+			c.flush(gen) // nolint: errcheck
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package stream_test
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stdiopt/stream"
+	"github.com/stdiopt/stream/streamtest"
+	"github.com/stdiopt/stream/strmutil"
+)
+
+func TestLineWith(t *testing.T) {
+	errFail := errors.New("fail")
+	input := make([]interface{}, 10)
+	want := make([]interface{}, 10)
+	for i := range input {
+		input[i] = i
+		want[i] = "ba" + string(rune('0'+i))
+	}
+	streamtest.Table(t,
+		streamtest.Case{
+			Name:  "batch",
+			Proc:  stream.LineWith(stream.BatchTransport(4, time.Millisecond), prefix("a"), prefix("b")),
+			Input: input,
+			Want:  want,
+		},
+		streamtest.Case{
+			Name:    "batch from context",
+			Context: stream.WithTransport(context.Background(), stream.BatchTransport(3, 0)),
+			Proc:    stream.Line(prefix("a"), prefix("b")),
+			Input:   input,
+			Want:    want,
+		},
+		streamtest.Case{
+			Name: "error",
+			Proc: stream.LineWith(stream.BatchTransport(4, 0),
+				prefix("a"),
+				func(p stream.Proc) error {
+					return p.Consume(func(v interface{}) error {
+						if v == "a3" {
+							return errFail
+						}
+						return p.Send(v)
+					})
+				},
+			),
+			Input:   input,
+			Want:    []interface{}{"a0", "a1", "a2"},
+			WantErr: errFail,
+		},
+	)
+}
+
+func TestBatchTransportLatency(t *testing.T) {
+	defer streamtest.LeakCheck(t)()
+
+	clk := streamtest.NewClock(time.Time{})
+	ctx := stream.WithClock(context.Background(), clk)
+	in := make(chan int)
+	out := make(chan int)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- stream.RunWithContext(ctx, stream.LineWith(stream.BatchTransport(64, time.Second),
+			strmutil.FromChan(in),
+			strmutil.ToChan(out),
+		))
+	}()
+
+	in <- 1
+	clk.BlockUntil(1)
+	select {
+	case v := <-out:
+		t.Fatalf("received %v before the latency elapsed", v)
+	case <-time.After(10 * time.Millisecond):
+	}
+	clk.Advance(time.Second)
+	if got := <-out; got != 1 {
+		t.Errorf("\nwant: %v\n got: %v\n", 1, got)
+	}
+	close(in)
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBatchTransportAck(t *testing.T) {
+	acked := make(chan error, 3)
+	input := make([]interface{}, 3)
+	for i := range input {
+		input[i] = stream.WithAck(i, func(err error) { acked <- err })
+	}
+	_, err := streamtest.Run(context.Background(),
+		stream.LineWith(stream.BatchTransport(2, 0), prefix("a"), prefix("b")),
+		input...,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range input {
+		if err := <-acked; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestBatchTransportSendWhileFlushing(t *testing.T) {
+	defer streamtest.LeakCheck(t)()
+
+	clk := streamtest.NewClock(time.Time{})
+	ctx, cancel := context.WithCancel(stream.WithClock(context.Background(), clk))
+	defer cancel()
+	q := stream.Link(ctx, stream.BatchTransport(3, time.Second), nil, nil)
+	s := q.(stream.Sender)
+
+	if err := s.Send(1); err != nil {
+		t.Fatal(err)
+	}
+	clk.BlockUntil(1)
+	clk.Advance(time.Second)
+	// the flusher took the batch and blocks until it's consumed
+	for stream.BatchLen(q) != 0 {
+		runtime.Gosched()
+	}
+	sent := make(chan error, 1)
+	go func() { sent <- s.Send(2) }()
+	select {
+	case err := <-sent:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Send blocked by the batch being flushed")
+	}
+	if got := stream.BatchLen(q); got != 1 {
+		t.Errorf("\nwant: %v\n got: %v\n", 1, got)
+	}
+}
+
+func TestBatchTransportCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	q := stream.Link(ctx, stream.BatchTransport(3, time.Hour), nil, nil)
+	cancel()
+	acked := make(chan error, 1)
+	err := q.(stream.Sender).Send(stream.WithAck(1, func(err error) { acked <- err }))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("\nwant: %v\n got: %v\n", context.Canceled, err)
+	}
+	select {
+	case err := <-acked:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("\nwant: %v\n got: %v\n", context.Canceled, err)
+		}
+	default:
+		t.Error("want the value released by the link")
+	}
+}
+
+func BenchmarkLine(b *testing.B) {
+	transports := []struct {
+		name string
+		pfn  func(pfns ...stream.ProcFunc) stream.ProcFunc
+	}{
+		{"chan", stream.Line},
+		{"batch", func(pfns ...stream.ProcFunc) stream.ProcFunc {
+			return stream.LineWith(stream.BatchTransport(64, time.Millisecond), pfns...)
+		}},
+		{"ring", func(pfns ...stream.ProcFunc) stream.ProcFunc {
+			return stream.LineWith(stream.RingTransport(256), pfns...)
+		}},
+	}
+	for _, tr := range transports {
+		tr := tr
+		b.Run(tr.name, func(b *testing.B) {
+			b.ReportAllocs()
+			err := stream.Run(tr.pfn(
+				func(p stream.Proc) error {
+					for i := 0; i < b.N; i++ {
+						if err := p.Send(i); err != nil {
+							return err
+						}
+					}
+					return nil
+				},
+				func(p stream.Proc) error {
+					return p.Consume(func(v interface{}) error {
+						return p.Send(v.(int) * 2)
+					})
+				},
+				func(p stream.Proc) error {
+					return p.Consume(func(interface{}) error { return nil })
+				},
+			))
+			if err != nil {
+				b.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Typed declares the type of the values consumed and sent by the Line of
+// pfns, the types are of the values without their Envelope and a nil type is
+// not checked, see Check.
+//		stream.Typed(reflect.TypeOf(""), reflect.TypeOf([]byte{}), fetch)
+func Typed(in, out reflect.Type, pfns ...ProcFunc) ProcFunc {
+	pfn := Line(pfns...)
+	return composite(func(p Proc) error {
+		if t := topologyFrom(p.Context()); t != nil {
+			c := describe(pfn, "")
+			c.in, c.out = in, out
+			if in != nil {
+				c.In = in.String()
+			}
+			if out != nil {
+				c.Out = out.String()
+			}
+			t.Children = append(t.Children, c)
+			return nil
+		}
+		return pfn(p)
+	})
+}
+
+// Check validates the declared types of pfns as a Line without running it, it
+// returns an error listing every stage that would consume values of a type it
+// doesn't accept. Values are checked without the Envelope.
+func Check(pfns ...ProcFunc) error {
+	return Describe(pfns...).typeCheck()
+}
+
+// typeCheck is Check of a described Line.
+func (t *Topology) typeCheck() error {
+	var errs []string
+	t.check(flow{}, &errs)
+	if len(errs) > 0 {
+		return fmt.Errorf("type check: %s", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+type checkKey struct{}
+
+// WithCheck returns a context where RunWithContext calls Check before running
+// the stream, Check describes every composition so it's not done by default.
+func WithCheck(ctx context.Context) context.Context {
+	return context.WithValue(ctx, checkKey{}, true)
+}
+
+func checkFrom(ctx context.Context) bool {
+	ok, _ := ctx.Value(checkKey{}).(bool)
+	return ok
+}
+
+// flow is the type of values sent by the stage from, typ is nil if unknown.
+type flow struct {
+	typ  reflect.Type
+	from string
+}
+
+// check checks the input flow against t and its children and returns the
+// output flow.
+func (t *Topology) check(in flow, errs *[]string) flow {
+	if t.in != nil {
+		t.checkIn(in, errs)
+		in = flow{t.in, in.from}
+	}
+	out := t.checkChildren(in, errs)
+	if t.out != nil {
+		out = flow{t.out, t.label()}
+	}
+	return out
+}
+
+func (t *Topology) checkIn(in flow, errs *[]string) {
+	if in.typ == nil || in.typ.AssignableTo(t.in) {
+		return
+	}
+	*errs = append(*errs, fmt.Sprintf(
+		"%s sends %v but %s consumes %v", in.from, in.typ, t.label(), t.in,
+	))
+}
+
+func (t *Topology) checkChildren(in flow, errs *[]string) flow {
+	switch t.Kind {
+	case "func":
+		return flow{}
+	case "broadcast", "balance":
+		outs := make([]flow, len(t.Children))
+		for i, c := range t.Children {
+			outs[i] = c.check(in, errs)
+		}
+		return commonFlow(outs)
+	case "ports":
+		outs := make([]flow, len(t.Children))
+		outs[0] = t.Children[0].check(in, errs)
+		for i, c := range t.Children[1:] {
+			outs[i+1] = c.check(flow{}, errs)
+		}
+		return commonFlow(outs)
+	case "graph":
+		return t.checkGraph(in, errs)
+	default:
+		for _, c := range t.Children {
+			in = c.check(in, errs)
+		}
+		return in
+	}
+}
+
+// checkGraph checks the nodes in topological order, a node consuming from
+// several nodes has each of them checked against its declared input.
+func (t *Topology) checkGraph(in flow, errs *[]string) flow {
+	index := map[string]*Topology{}
+	incoming := map[string][]flow{}
+	pending := map[string]int{}
+	outs := map[string][]TopologyEdge{}
+	for _, c := range t.Children {
+		index[c.Name] = c
+	}
+	for _, e := range t.Edges {
+		pending[e.To]++
+		outs[e.From] = append(outs[e.From], e)
+	}
+	queue := []string{}
+	for _, c := range t.Children {
+		if pending[c.Name] == 0 {
+			queue = append(queue, c.Name)
+			incoming[c.Name] = []flow{in}
+		}
+	}
+	var exits []flow
+	for len(queue) > 0 {
+		c := index[queue[0]]
+		queue = queue[1:]
+
+		fs := incoming[c.Name]
+		in := commonFlow(fs)
+		if c.in != nil {
+			for _, f := range fs {
+				c.checkIn(f, errs)
+			}
+			in = flow{}
+		}
+		out := c.check(in, errs)
+		main := false
+		for _, e := range outs[c.Name] {
+			f := out
+			if e.Port != "" {
+				f = flow{}
+			} else {
+				main = true
+			}
+			incoming[e.To] = append(incoming[e.To], f)
+			if pending[e.To]--; pending[e.To] == 0 {
+				queue = append(queue, e.To)
+			}
+		}
+		if !main {
+			exits = append(exits, out)
+		}
+	}
+	return commonFlow(exits)
+}
+
+// commonFlow returns the flow if every flow has the same known type.
+func commonFlow(fs []flow) flow {
+	if len(fs) == 0 || fs[0].typ == nil {
+		return flow{}
+	}
+	for _, f := range fs[1:] {
+		if f.typ != fs[0].typ {
+			return flow{}
+		}
+	}
+	return fs[0]
+}
+
+func (t *Topology) label() string {
+	switch {
+	case t.Name != "":
+		return t.Name
+	case t.Func != "":
+		return t.Func
+	default:
+		return t.Kind
+	}
+}
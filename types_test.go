@@ -0,0 +1,142 @@
+package stream_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stdiopt/stream"
+	"github.com/stdiopt/stream/strmutil"
+)
+
+func TestCheck(t *testing.T) {
+	var (
+		intType    = reflect.TypeOf(0)
+		stringType = reflect.TypeOf("")
+		bytesType  = reflect.TypeOf([]byte{})
+		anyType    = reflect.TypeOf((*interface{})(nil)).Elem()
+	)
+	g, err := stream.NewGraph().
+		Node("ints", stream.Typed(nil, intType, strmutil.Value(1))).
+		Node("strings", stream.Typed(nil, stringType, strmutil.Value("1"))).
+		Node("parse", strmutil.JSONParse(nil)).
+		Edge("ints", "parse").
+		Edge("strings", "parse").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		pfns []stream.ProcFunc
+		want string
+	}{
+		{
+			name: "compatible",
+			pfns: []stream.ProcFunc{
+				strmutil.Value("http://localhost"),
+				strmutil.HTTPGet(nil),
+				strmutil.JSONParse(nil),
+			},
+		},
+		{
+			name: "typed stages match",
+			pfns: []stream.ProcFunc{
+				stream.Typed(nil, stringType, strmutil.Value("1")),
+				stream.Typed(stringType, bytesType, prefix("")),
+				strmutil.JSONParse(nil),
+			},
+		},
+		{
+			name: "mismatch",
+			pfns: []stream.ProcFunc{
+				strmutil.Seq(0, 10, 1),
+				strmutil.JSONParse(nil),
+			},
+			want: "type check: strmutil.Seq sends int but strmutil.JSONParse consumes []uint8",
+		},
+		{
+			name: "assignable to interface",
+			pfns: []stream.ProcFunc{
+				strmutil.Seq(0, 10, 1),
+				stream.Typed(anyType, nil, prefix("")),
+			},
+		},
+		{
+			name: "unknown types are not checked",
+			pfns: []stream.ProcFunc{
+				strmutil.Seq(0, 10, 1),
+				prefix(""),
+				strmutil.JSONParse(nil),
+			},
+		},
+		{
+			name: "nested",
+			pfns: []stream.ProcFunc{
+				strmutil.Seq(0, 10, 1),
+				stream.Workers(2, stream.Buffer(1,
+					stream.Broadcast(
+						stream.Typed(intType, bytesType, prefix("")),
+						stream.Named("parse", strmutil.JSONParse(nil)),
+					),
+				)),
+			},
+			want: "type check: strmutil.Seq sends int but parse consumes []uint8",
+		},
+		{
+			name: "graph",
+			pfns: []stream.ProcFunc{g},
+			want: "type check: ints sends int but parse consumes []uint8, " +
+				"strings sends string but parse consumes []uint8",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := stream.Check(tt.pfns...)
+			got := ""
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tt.want {
+				t.Errorf("\nwant: %v\n got: %v\n", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRunCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		wantRan bool
+	}{
+		{name: "not checked", ctx: context.Background(), wantRan: true},
+		{name: "checked", ctx: stream.WithCheck(context.Background())},
+		{
+			name:    "collect not checked",
+			ctx:     stream.WithCollectErrors(context.Background(), 10),
+			wantRan: true,
+		},
+		{
+			name: "collect checked",
+			ctx:  stream.WithCheck(stream.WithCollectErrors(context.Background(), 10)),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ran := false
+			err := stream.RunWithContext(tt.ctx,
+				stream.Typed(nil, reflect.TypeOf(0), func(p stream.Proc) error {
+					ran = true
+					return p.Send(1)
+				}),
+				strmutil.JSONParse(nil),
+			)
+			if checked := err != nil && strings.HasPrefix(err.Error(), "type check:"); checked == tt.wantRan || ran != tt.wantRan {
+				t.Errorf("\nwant: ran: %v\n got: ran: %v, err: %v\n", tt.wantRan, ran, err)
+			}
+		})
+	}
+}